@@ -2,19 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/proxy-checker-api/internal/aggregator"
 	"github.com/proxy-checker-api/internal/api"
+	"github.com/proxy-checker-api/internal/auth"
 	"github.com/proxy-checker-api/internal/checker"
 	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/cycle"
+	"github.com/proxy-checker-api/internal/geoip"
 	"github.com/proxy-checker-api/internal/metrics"
+	"github.com/proxy-checker-api/internal/ratelimit"
 	"github.com/proxy-checker-api/internal/snapshot"
 	"github.com/proxy-checker-api/internal/storage"
+	"github.com/proxy-checker-api/internal/targets"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -51,6 +60,15 @@ func main() {
 	}
 	defer store.Close()
 
+	// Proxy credentials are encrypted before they reach the backend
+	if cfg.Storage.CredentialsKeyEnv != "" && os.Getenv(cfg.Storage.CredentialsKeyEnv) == "" {
+		log.Warnf("%s is not set, proxies with credentials will not be persisted", cfg.Storage.CredentialsKeyEnv)
+	}
+	store, err = storage.NewCredentialStorage(store, os.Getenv(cfg.Storage.CredentialsKeyEnv))
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
 	// Initialize snapshot manager
 	snapshotMgr := snapshot.NewManager(store, cfg.Storage.PersistIntervalSeconds)
 
@@ -61,34 +79,98 @@ func main() {
 
 	// Initialize aggregator
 	agg := aggregator.NewAggregator(cfg.Aggregator, metricsCollector)
+	if err := agg.EnablePersistence(store); err != nil {
+		log.Warnf("Failed to load persisted sources: %v (using config)", err)
+	}
 
 	// Initialize checker
 	chk := checker.NewChecker(cfg.Checker, metricsCollector)
+	chk.SetAddrGuard(agg.CheckDialAddr)
+
+	// Initialize API key registry
+	var keyStore auth.KeyStore = auth.NewStorageKeyStore(store)
+	if cfg.API.KeysFile != "" {
+		keyStore = auth.NewFileKeyStore(cfg.API.KeysFile)
+	}
+	keys, err := auth.NewRegistry(keyStore)
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	if secret := os.Getenv(cfg.API.APIKeyEnv); cfg.API.APIKeyEnv != "" && secret != "" {
+		// The legacy single key keeps full access
+		keys.AddStatic("default", secret, []string{auth.ScopeAdmin})
+	}
+
+	// Initialize rate limiter backend
+	limiter, err := ratelimit.NewLimiter(cfg.API.RateLimitBackend, cfg.API.RateLimitRedisAddr)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
 
 	// Context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Daily quota usage is saved periodically so it survives restarts
+	go keys.PersistUsage(ctx)
+
+	// GeoIP databases, reloaded when their files change
+	geo := geoip.NewResolver(ctx, cfg.GeoIP)
+
+	// Target profiles, checked on their own intervals
+	monitor := targets.NewMonitor(chk, snapshotMgr, metricsCollector, cfg.Checker.Targets)
+	go monitor.Run(ctx)
+
 	// Start aggregation loop
-	go runAggregationLoop(ctx, agg, chk, snapshotMgr, cfg.Aggregator.IntervalSeconds)
+	runner := cycle.NewRunner(ctx, agg, chk, snapshotMgr, geo, monitor)
+	intervalChanged := make(chan struct{}, 1)
+	go runAggregationLoop(ctx, runner, agg, intervalChanged)
+	go agg.RunScheduler(ctx)
+
+	// Re-run the cycle when watched local source files change
+	if err := agg.WatchLocalSources(ctx, func(source string) {
+		runner.Trigger("watch")
+	}); err != nil {
+		log.Warnf("Failed to watch local sources: %v", err)
+	}
 
 	// Start API server
-	apiServer := api.NewServer(cfg, snapshotMgr, metricsCollector, agg, chk)
+	apiServer := api.NewServer(cfg, snapshotMgr, metricsCollector, agg, chk, keys, limiter, runner)
 	go func() {
-		if err := apiServer.Start(); err != nil {
+		if err := apiServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("API server failed: %v", err)
 		}
 	}()
 
 	log.Infof("Service started successfully on %s", cfg.API.Addr)
 
+	// Hot reload: SIGHUP always, file changes when enabled. cfg keeps the
+	// startup values; reloads publish new configs.
+	reload := func() {
+		reloadConfig(cfg, agg, chk, geo, monitor, apiServer, intervalChanged)
+	}
+	if cfg.HotReload.WatchFile {
+		if err := config.Watch(ctx, cfg.FilePath(), reload); err != nil {
+			log.Warnf("Failed to watch config file: %v (SIGHUP reload still available)", err)
+		} else {
+			log.Infof("Watching %s for changes", cfg.FilePath())
+		}
+	}
+
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Info("SIGHUP received, reloading configuration")
+		reload()
+	}
 
 	log.Info("Shutting down gracefully...")
 	cancel()
+	runner.Wait()
 
 	// Graceful shutdown with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -97,97 +179,78 @@ func main() {
 	if err := apiServer.Shutdown(shutdownCtx); err != nil {
 		log.Errorf("API server shutdown error: %v", err)
 	}
+	if err := keys.FlushUsage(); err != nil {
+		log.Errorf("Failed to persist API key usage: %v", err)
+	}
 
 	log.Info("Shutdown complete")
 }
 
-func runAggregationLoop(ctx context.Context, agg *aggregator.Aggregator, chk *checker.Checker, snap *snapshot.Manager, intervalSeconds int) {
-	// Run immediately on startup
-	runAggregationCycle(ctx, agg, chk, snap)
+// reloadMu serializes reloads triggered by SIGHUP and the file watcher
+var reloadMu sync.Mutex
 
-	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
-	defer ticker.Stop()
+// reloadConfig re-reads the config file and applies every setting that can
+// change at runtime. Settings that need a restart are reported, not applied.
+func reloadConfig(startupCfg *config.Config, agg *aggregator.Aggregator, chk *checker.Checker,
+	geo *geoip.Resolver, monitor *targets.Monitor, apiServer *api.Server, intervalChanged chan<- struct{}) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Info("Aggregation loop stopped")
-			return
-		case <-ticker.C:
-			runAggregationCycle(ctx, agg, chk, snap)
-		}
-	}
-}
-
-func runAggregationCycle(ctx context.Context, agg *aggregator.Aggregator, chk *checker.Checker, snap *snapshot.Manager) {
-	start := time.Now()
-	log.Info("Starting aggregation cycle")
-
-	// Fetch proxies from sources
-	proxies, sourceStats, err := agg.Aggregate(ctx)
+	previous := config.GetGlobal()
+	cfg, err := previous.Reload()
 	if err != nil {
-		log.Errorf("Aggregation failed: %v", err)
+		log.Errorf("Config reload failed, keeping current config: %v", err)
 		return
 	}
 
-	totalScraped := len(proxies)
-	log.Infof("Aggregated %d unique proxies from %d sources", totalScraped, len(sourceStats))
-
-	if totalScraped == 0 {
-		log.Warn("No proxies aggregated, skipping check cycle")
-		return
+	if level, err := log.ParseLevel(cfg.Logging.Level); err == nil {
+		log.SetLevel(level)
 	}
 
-	// Check proxies
-	checkStart := time.Now()
-	results := chk.CheckProxies(ctx, proxies)
-	checkDuration := time.Since(checkStart)
-
-	aliveCount := 0
-	deadCount := 0
-	aliveProxies := make([]snapshot.Proxy, 0, len(results))
-
-	for _, result := range results {
-		if result.Alive {
-			aliveCount++
-			aliveProxies = append(aliveProxies, snapshot.Proxy{
-				Address:   result.Proxy,
-				Alive:     true,
-				LatencyMs: result.LatencyMs,
-				LastCheck: time.Now(),
-			})
-		} else {
-			deadCount++
-		}
-	}
+	chk.UpdateConfig(cfg.Checker)
+	geo.UpdateConfig(cfg.GeoIP)
+	monitor.UpdateConfig(cfg.Checker.Targets)
 
-	alivePercent := 0.0
-	if totalScraped > 0 {
-		alivePercent = float64(aliveCount) / float64(totalScraped) * 100.0
+	if err := agg.UpdateConfig(cfg.Aggregator); err != nil {
+		log.Errorf("Failed to apply aggregator config: %v", err)
+	}
+	if previous.Aggregator.IntervalSeconds != cfg.Aggregator.IntervalSeconds {
+		select {
+		case intervalChanged <- struct{}{}:
+		default:
+		}
 	}
 
-	log.Infof("Check complete: %d alive, %d dead (%.2f%% alive) in %v",
-		aliveCount, deadCount, alivePercent, checkDuration)
+	apiServer.UpdateConfig(cfg.API)
 
-	// Update snapshot
-	stats := snapshot.Stats{
-		TotalScraped:  totalScraped,
-		TotalAlive:    aliveCount,
-		TotalDead:     deadCount,
-		AlivePercent:  alivePercent,
-		LastCheckTime: time.Now(),
-		SourceStats:   sourceStats,
+	if restart := config.RestartRequired(startupCfg, cfg); len(restart) > 0 {
+		log.Warnf("Config reloaded; these changes require a restart to take effect: %s",
+			strings.Join(restart, ", "))
+	} else {
+		log.Info("Config reloaded")
 	}
+}
 
-	snap.Update(aliveProxies, stats)
+func runAggregationLoop(ctx context.Context, runner *cycle.Runner, agg *aggregator.Aggregator,
+	intervalChanged <-chan struct{}) {
+	// Run immediately on startup
+	runner.Run("startup")
 
-	totalDuration := time.Since(start)
-	log.Infof("Aggregation cycle complete in %v", totalDuration)
+	interval := agg.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	// Log memory stats
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	log.Infof("Memory: Alloc=%dMB, TotalAlloc=%dMB, Sys=%dMB, NumGC=%d, Goroutines=%d",
-		m.Alloc/1024/1024, m.TotalAlloc/1024/1024, m.Sys/1024/1024, m.NumGC, runtime.NumGoroutine())
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Aggregation loop stopped")
+			return
+		case <-intervalChanged:
+			interval = agg.Interval()
+			ticker.Reset(interval)
+			log.Infof("Aggregation interval changed to %v", interval)
+		case <-ticker.C:
+			runner.Run("schedule")
+		}
+	}
 }
-
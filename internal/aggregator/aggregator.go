@@ -1,116 +1,185 @@
 package aggregator
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
-	"regexp"
-	"strings"
+	"reflect"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/proxy-checker-api/internal/config"
 	"github.com/proxy-checker-api/internal/metrics"
+	"github.com/proxy-checker-api/internal/storage"
+	"github.com/proxy-checker-api/internal/types"
 	log "github.com/sirupsen/logrus"
 )
 
-var (
-	// Regex to match proxy formats: IP:PORT or http://IP:PORT
-	proxyRegex = regexp.MustCompile(`(?:http://)?(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}):(\d{2,5})`)
-)
-
 type Aggregator struct {
-	config  config.AggregatorConfig
-	metrics *metrics.Collector
-	client  *http.Client
+	configMu sync.RWMutex
+	config   config.AggregatorConfig
+	metrics  *metrics.Collector
+
+	client    *http.Client // direct fetches; timeouts come from the request context
+	clientsMu sync.Mutex
+	clients   map[string]*http.Client // by upstream proxy URL
+
+	providersMu sync.RWMutex
+	providers   map[string]ProviderFactory // by source type (URL scheme)
+
+	sourcesMu sync.RWMutex
+	sources   []config.Source
+	store     storage.Storage // persists runtime source edits, nil when disabled
+
+	watchMu sync.Mutex
+	watcher *fsnotify.Watcher // set by WatchLocalSources
+
+	healthMu sync.Mutex
+	health   map[string]*SourceHealth // by source name
+
+	fetchMu   sync.Mutex // serializes fetch passes of cycles and the scheduler
+	resultsMu sync.Mutex
+	results   map[string]*sourceResult // by source name
+	wake      chan struct{}            // nudges the scheduler after source changes
+
+	cacheMu sync.Mutex
+	cache   map[string]*cacheEntry // by source name
+
+	ingestMu sync.Mutex
+	ingested map[string]map[string]*ingestEntry // virtual source -> candidate key
 }
 
 type SourceStats struct {
 	URL          string
 	ProxiesFound int
 	Error        string
+	CacheHit     bool       // the cached result was used (304, or a stale fallback)
+	Stale        bool       // the fetch failed and a cached result within max staleness was used
+	FetchedAt    time.Time  // when the returned content was last fetched or revalidated
+	NextFetch    *time.Time // for sources with their own interval or schedule
+	Pages        int        // pages crawled, for paginated sources
 }
 
 func NewAggregator(cfg config.AggregatorConfig, metricsCollector *metrics.Collector) *Aggregator {
-	return &Aggregator{
-		config:  cfg,
-		metrics: metricsCollector,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        10,
-				MaxIdleConnsPerHost: 2,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		},
+	a := &Aggregator{
+		config:   cfg,
+		metrics:  metricsCollector,
+		sources:  append([]config.Source(nil), cfg.Sources...),
+		results:  make(map[string]*sourceResult),
+		wake:     make(chan struct{}, 1),
+		cache:    make(map[string]*cacheEntry),
+		health:   make(map[string]*SourceHealth),
+		ingested: make(map[string]map[string]*ingestEntry),
+		client:   &http.Client{Transport: newTransport(nil)},
+		clients:  make(map[string]*http.Client),
+
+		providers: make(map[string]ProviderFactory),
 	}
+	a.registerBuiltinProviders()
+	return a
 }
 
-// Aggregate fetches proxies from all enabled sources
-func (a *Aggregator) Aggregate(ctx context.Context) ([]string, map[string]SourceStats, error) {
-	enabledSources := make([]config.Source, 0)
-	for _, source := range a.config.Sources {
-		if source.Enabled {
-			enabledSources = append(enabledSources, source)
-		}
+// UpdateConfig applies reloaded aggregator settings. The source list is only
+// replaced when the configured list itself changed, so edits made through
+// the admin API survive unrelated reloads.
+func (a *Aggregator) UpdateConfig(cfg config.AggregatorConfig) error {
+	a.configMu.Lock()
+	sourcesChanged := !reflect.DeepEqual(a.config.Sources, cfg.Sources)
+	a.config = cfg
+	a.configMu.Unlock()
+
+	if !sourcesChanged {
+		return nil
 	}
 
-	if len(enabledSources) == 0 {
-		return nil, nil, fmt.Errorf("no enabled sources")
+	a.sourcesMu.Lock()
+	previous := a.sources
+	a.sources = append([]config.Source(nil), cfg.Sources...)
+	if err := a.persistLocked(); err != nil {
+		a.sources = previous
+		a.sourcesMu.Unlock()
+		return err
 	}
+	a.sourcesMu.Unlock()
 
-	log.Infof("Fetching from %d sources", len(enabledSources))
-
-	var wg sync.WaitGroup
-	resultChan := make(chan []string, len(enabledSources))
-	statsChan := make(chan SourceStats, len(enabledSources))
+	a.refreshWatches()
+	a.wakeScheduler()
+	log.Infof("Sources replaced from config: %d sources", len(cfg.Sources))
+	return nil
+}
 
-	// Fetch from all sources concurrently
-	for _, source := range enabledSources {
-		wg.Add(1)
-		go func(src config.Source) {
-			defer wg.Done()
+// Interval returns how often the aggregation cycle should run
+func (a *Aggregator) Interval() time.Duration {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return time.Duration(a.config.IntervalSeconds) * time.Second
+}
 
-			startTime := time.Now()
-			proxies, err := a.fetchSource(ctx, src)
-			duration := time.Since(startTime)
+func (a *Aggregator) userAgent() string {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config.UserAgent
+}
 
-			stat := SourceStats{
-				URL:          src.URL,
-				ProxiesFound: len(proxies),
-			}
+// Aggregate fetches the enabled sources that are due and returns the merged
+// candidate set: the latest result of every enabled source plus the
+// candidates pushed through Ingest. Sources without their own interval or
+// schedule are fetched on every call.
+func (a *Aggregator) Aggregate(ctx context.Context) ([]types.Candidate, map[string]SourceStats, error) {
+	sources := a.Sources()
+	a.pruneCache(sources)
+	a.pruneHealth(sources)
 
-			if err != nil {
-				stat.Error = err.Error()
-				log.Warnf("Source %s failed: %v (took %v)", src.URL, err, duration)
-			} else {
-				log.Infof("Source %s returned %d proxies (took %v)", src.URL, len(proxies), duration)
-			}
+	enabledSources := a.activeSources()
+	a.pruneResults(enabledSources)
 
-			a.metrics.RecordProxiesScraped(src.URL, len(proxies))
+	ingested := a.ingestSources()
 
-			resultChan <- proxies
-			statsChan <- stat
-		}(source)
+	if len(enabledSources) == 0 && len(ingested) == 0 {
+		return nil, nil, fmt.Errorf("no enabled sources")
 	}
 
-	// Wait for all fetches to complete
-	wg.Wait()
-	close(resultChan)
-	close(statsChan)
-
-	// Collect results
-	allProxies := make([]string, 0)
-	for proxies := range resultChan {
-		allProxies = append(allProxies, proxies...)
+	a.fetchMu.Lock()
+	due := a.dueSources(enabledSources, time.Now(), false)
+	log.Infof("Fetching from %d of %d sources", len(due), len(enabledSources))
+	if len(due) > 0 {
+		a.fetchSources(ctx, due)
 	}
+	a.fetchMu.Unlock()
 
+	// Merge the latest result of every enabled source
+	allProxies := make([]types.Candidate, 0)
 	sourceStats := make(map[string]SourceStats)
-	for stat := range statsChan {
+
+	a.resultsMu.Lock()
+	for _, source := range enabledSources {
+		result, ok := a.results[source.Name]
+		if !ok {
+			continue
+		}
+		allProxies = appendFromSource(allProxies, result.proxies, source.Name)
+
+		stat := result.stat
+		if !result.nextFetch.IsZero() {
+			next := result.nextFetch
+			stat.NextFetch = &next
+		}
 		sourceStats[stat.URL] = stat
 	}
+	a.resultsMu.Unlock()
+
+	for _, name := range ingested {
+		url := ingestURLPrefix + name
+		proxies, err := a.fetchSource(ctx, config.Source{Name: url, URL: url})
+		stat := SourceStats{URL: url, ProxiesFound: len(proxies)}
+		if err != nil {
+			stat.Error = err.Error()
+		}
+		allProxies = appendFromSource(allProxies, proxies, url)
+		sourceStats[url] = stat
+		a.metrics.RecordProxiesScraped(url, len(proxies))
+	}
 
 	// Deduplicate
 	unique := deduplicateProxies(allProxies)
@@ -119,71 +188,64 @@ func (a *Aggregator) Aggregate(ctx context.Context) ([]string, map[string]Source
 	return unique, sourceStats, nil
 }
 
-func (a *Aggregator) fetchSource(ctx context.Context, source config.Source) ([]string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", source.URL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	if a.config.UserAgent != "" {
-		req.Header.Set("User-Agent", a.config.UserAgent)
-	}
-
-	resp, err := a.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("fetch: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+// appendFromSource appends candidates tagged with the source that listed
+// them, and the archive entry they came from if any
+func appendFromSource(dst, candidates []types.Candidate, source string) []types.Candidate {
+	// Shared by every candidate of the source or entry; mergeSources copies
+	// before appending
+	tag := []string{source}
+	entryTags := make(map[string][]string)
+	for _, candidate := range candidates {
+		candidate.Sources = tag
+		if candidate.Entry != "" {
+			entryTag, ok := entryTags[candidate.Entry]
+			if !ok {
+				entryTag = []string{source + "#" + candidate.Entry}
+				entryTags[candidate.Entry] = entryTag
+			}
+			candidate.Sources = entryTag
+		}
+		dst = append(dst, candidate)
 	}
-
-	// Limit body read to 10MB
-	limitedReader := io.LimitReader(resp.Body, 10*1024*1024)
-
-	return parseProxies(limitedReader)
+	return dst
 }
 
-func parseProxies(r io.Reader) ([]string, error) {
-	proxies := make([]string, 0)
-	scanner := bufio.NewScanner(r)
+// deduplicateProxies keeps the first occurrence of each normalized proxy,
+// filling in metadata missing there from later occurrences and merging the
+// sources that listed it
+func deduplicateProxies(proxies []types.Candidate) []types.Candidate {
+	seen := make(map[string]int, len(proxies))
+	unique := make([]types.Candidate, 0, len(proxies))
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
+	for _, proxy := range proxies {
+		normalized := proxy.Key()
+		if i, exists := seen[normalized]; exists {
+			if unique[i].Country == "" {
+				unique[i].Country = proxy.Country
+			}
+			unique[i].Sources = mergeSources(unique[i].Sources, proxy.Sources)
 			continue
 		}
-
-		// Extract proxy using regex
-		matches := proxyRegex.FindStringSubmatch(line)
-		if len(matches) >= 3 {
-			ip := matches[1]
-			port := matches[2]
-			proxy := fmt.Sprintf("%s:%s", ip, port)
-			proxies = append(proxies, proxy)
-		}
+		seen[normalized] = len(unique)
+		unique = append(unique, proxy)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return proxies, fmt.Errorf("scan: %w", err)
-	}
-
-	return proxies, nil
+	return unique
 }
 
-func deduplicateProxies(proxies []string) []string {
-	seen := make(map[string]struct{}, len(proxies))
-	unique := make([]string, 0, len(proxies))
-
-	for _, proxy := range proxies {
-		normalized := strings.ToLower(strings.TrimSpace(proxy))
-		if _, exists := seen[normalized]; !exists {
-			seen[normalized] = struct{}{}
-			unique = append(unique, proxy)
+// mergeSources appends the sources in add that are not yet in have
+func mergeSources(have, add []string) []string {
+	for _, source := range add {
+		found := false
+		for _, existing := range have {
+			if existing == source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			have = append(have[:len(have):len(have)], source)
 		}
 	}
-
-	return unique
+	return have
 }
-
@@ -0,0 +1,116 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheEntry is the last good result of a source
+type cacheEntry struct {
+	fingerprint  string // what was fetched and how; a changed source starts fresh
+	etag         string
+	lastModified string
+	proxies      []types.Candidate
+	fetchedAt    time.Time // last 200 or 304
+}
+
+// maxStaleness returns how old a cached result may be to stand in for a
+// failed fetch; zero disables the fallback
+func (a *Aggregator) maxStaleness() time.Duration {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	if a.config.CacheMaxStalenessSeconds < 0 {
+		return 0
+	}
+	return time.Duration(a.config.CacheMaxStalenessSeconds) * time.Second
+}
+
+// fetchCached fetches a source, conditionally if its provider supports it,
+// falling back to the cached result on 304 or transient failures, and
+// records cache use in stat
+func (a *Aggregator) fetchCached(ctx context.Context, source config.Source, stat *SourceStats) ([]types.Candidate, error) {
+	provider, err := a.providerFor(source)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := sourceFingerprint(source)
+
+	a.cacheMu.Lock()
+	cached := a.cache[source.Name]
+	a.cacheMu.Unlock()
+	if cached != nil && cached.fingerprint != fingerprint {
+		cached = nil
+	}
+
+	var result httpResult
+	if r, ok := provider.(revalidator); ok {
+		result, err = r.fetchIfModified(ctx, cached)
+	} else {
+		result.proxies, err = provider.Fetch(ctx)
+	}
+	now := time.Now()
+
+	switch {
+	case err == nil && result.notModified:
+		a.cacheMu.Lock()
+		cached.fetchedAt = now
+		a.cacheMu.Unlock()
+		stat.CacheHit = true
+		stat.FetchedAt = now
+		return cached.proxies, nil
+
+	case err == nil:
+		stat.Pages = result.pages
+		a.cacheMu.Lock()
+		a.cache[source.Name] = &cacheEntry{
+			fingerprint:  fingerprint,
+			etag:         result.etag,
+			lastModified: result.lastModified,
+			proxies:      result.proxies,
+			fetchedAt:    now,
+		}
+		a.cacheMu.Unlock()
+		stat.FetchedAt = now
+		return result.proxies, nil
+
+	case cached != nil && isTransient(err) && now.Sub(cached.fetchedAt) <= a.maxStaleness():
+		log.Warnf("Source %s failed (%v), using result cached %v ago",
+			source.URL, err, now.Sub(cached.fetchedAt).Round(time.Second))
+		stat.CacheHit = true
+		stat.Stale = true
+		stat.FetchedAt = cached.fetchedAt
+		return cached.proxies, err
+
+	default:
+		return nil, err
+	}
+}
+
+// pruneCache drops entries of sources that no longer exist
+func (a *Aggregator) pruneCache(sources []config.Source) {
+	names := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		names[source.Name] = true
+	}
+
+	a.cacheMu.Lock()
+	defer a.cacheMu.Unlock()
+	for name := range a.cache {
+		if !names[name] {
+			delete(a.cache, name)
+		}
+	}
+}
+
+func sourceFingerprint(source config.Source) string {
+	source.Enabled = false
+	source.Watch = false
+	data, _ := json.Marshal(source)
+	return string(data)
+}
@@ -0,0 +1,139 @@
+package aggregator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+)
+
+// fakeListServer serves a proxy list with an ETag, answers conditional
+// requests with 304 and fails with status when set
+type fakeListServer struct {
+	mu          sync.Mutex
+	status      int
+	ifNoneMatch []string
+}
+
+func (f *fakeListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ifNoneMatch = append(f.ifNoneMatch, r.Header.Get("If-None-Match"))
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", `"v1"`)
+	w.Write([]byte("1.2.3.4:80\n5.6.7.8:80\n"))
+}
+
+func (f *fakeListServer) fail(status int) {
+	f.mu.Lock()
+	f.status = status
+	f.mu.Unlock()
+}
+
+func (f *fakeListServer) lastIfNoneMatch() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ifNoneMatch[len(f.ifNoneMatch)-1]
+}
+
+func TestFetchCachedRevalidates(t *testing.T) {
+	server := &fakeListServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	a := NewAggregator(config.AggregatorConfig{CacheMaxStalenessSeconds: 3600}, testMetrics)
+	source := config.Source{Name: "list", URL: ts.URL, Type: "txt", Enabled: true}
+
+	var stat SourceStats
+	proxies, err := a.fetchCached(context.Background(), source, &stat)
+	if err != nil || len(proxies) != 2 || stat.CacheHit {
+		t.Fatalf("first fetch = %d proxies, %v, cache hit %t; want 2 fresh proxies", len(proxies), err, stat.CacheHit)
+	}
+	if got := server.lastIfNoneMatch(); got != "" {
+		t.Errorf("first fetch sent If-None-Match %q", got)
+	}
+
+	stat = SourceStats{}
+	proxies, err = a.fetchCached(context.Background(), source, &stat)
+	if err != nil || len(proxies) != 2 || !stat.CacheHit || stat.Stale {
+		t.Fatalf("revalidation = %d proxies, %v, %+v; want 2 cached proxies", len(proxies), err, stat)
+	}
+	if got := server.lastIfNoneMatch(); got != `"v1"` {
+		t.Errorf("revalidation sent If-None-Match %q, want %q", got, `"v1"`)
+	}
+
+	// A changed source definition does not reuse the old validators
+	changed := source
+	changed.Request = &config.RequestOptions{Headers: map[string]string{"X-Test": "1"}}
+	stat = SourceStats{}
+	if _, err := a.fetchCached(context.Background(), changed, &stat); err != nil || stat.CacheHit {
+		t.Fatalf("changed source = %v, cache hit %t; want a fresh fetch", err, stat.CacheHit)
+	}
+	if got := server.lastIfNoneMatch(); got != "" {
+		t.Errorf("changed source sent If-None-Match %q", got)
+	}
+}
+
+func TestFetchCachedStaleFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		staleness int
+		age       time.Duration
+		status    int
+		wantStale bool
+	}{
+		{"server error", 3600, time.Minute, http.StatusBadGateway, true},
+		{"rate limited", 3600, time.Minute, http.StatusTooManyRequests, true},
+		{"not found is not transient", 3600, time.Minute, http.StatusNotFound, false},
+		{"forbidden is not transient", 3600, time.Minute, http.StatusForbidden, false},
+		{"too old", 3600, 2 * time.Hour, http.StatusBadGateway, false},
+		{"fallback disabled", -1, time.Minute, http.StatusBadGateway, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeListServer{}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			a := NewAggregator(config.AggregatorConfig{CacheMaxStalenessSeconds: tt.staleness}, testMetrics)
+			source := config.Source{Name: "list", URL: ts.URL, Type: "txt", Enabled: true}
+			if _, err := a.fetchCached(context.Background(), source, &SourceStats{}); err != nil {
+				t.Fatalf("priming fetch: %v", err)
+			}
+			fetchedAt := time.Now().Add(-tt.age)
+			a.cacheMu.Lock()
+			a.cache[source.Name].fetchedAt = fetchedAt
+			a.cacheMu.Unlock()
+
+			server.fail(tt.status)
+			var stat SourceStats
+			proxies, err := a.fetchCached(context.Background(), source, &stat)
+			if err == nil {
+				t.Fatal("failed fetch returned no error")
+			}
+			if stat.Stale != tt.wantStale || stat.CacheHit != tt.wantStale {
+				t.Fatalf("stat = %+v, want stale %t", stat, tt.wantStale)
+			}
+			if tt.wantStale {
+				if len(proxies) != 2 || !stat.FetchedAt.Equal(fetchedAt) {
+					t.Errorf("stale result = %d proxies fetched at %v, want 2 from %v", len(proxies), stat.FetchedAt, fetchedAt)
+				}
+			} else if len(proxies) != 0 {
+				t.Errorf("got %d proxies without a usable cache", len(proxies))
+			}
+		})
+	}
+}
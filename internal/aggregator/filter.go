@@ -0,0 +1,305 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons a candidate is dropped before checking
+const (
+	DropBogon          = "bogon"
+	DropDeniedCIDR     = "denied_cidr"
+	DropNotAllowedCIDR = "not_allowed_cidr"
+	DropDeniedPort     = "denied_port"
+	DropNotAllowedPort = "not_allowed_port"
+	DropInvalid        = "invalid_address"
+	DropUnresolved     = "unresolved"
+)
+
+// Hostname candidates are resolved before the address rules apply
+const (
+	resolveTimeout     = 5 * time.Second
+	resolveConcurrency = 64
+)
+
+// bogonPrefixes are ranges that never hold usable public proxies:
+// unspecified, private, shared, loopback, link-local, documentation,
+// benchmarking, multicast and reserved space
+var bogonPrefixes = mustPrefixes(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustPrefixes(cidrs ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefixes[i] = netip.MustParsePrefix(cidr)
+	}
+	return prefixes
+}
+
+type portRange struct{ lo, hi int }
+
+// candidateFilter is the compiled form of config.FilterConfig
+type candidateFilter struct {
+	allowBogons           bool
+	allowCIDRs, denyCIDRs []netip.Prefix
+	allowPorts, denyPorts []portRange
+
+	// resolved holds the addresses of hostname candidates, nil for those
+	// that did not resolve; unset when no address rule applies
+	resolved map[string][]netip.Addr
+}
+
+func newCandidateFilter(cfg config.FilterConfig) (*candidateFilter, error) {
+	f := &candidateFilter{allowBogons: cfg.AllowBogons}
+
+	for _, list := range []struct {
+		cidrs []string
+		dst   *[]netip.Prefix
+	}{{cfg.AllowCIDRs, &f.allowCIDRs}, {cfg.DenyCIDRs, &f.denyCIDRs}} {
+		for _, cidr := range list.cidrs {
+			prefix, err := config.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			*list.dst = append(*list.dst, prefix)
+		}
+	}
+
+	for _, list := range []struct {
+		specs []string
+		dst   *[]portRange
+	}{{cfg.AllowPorts, &f.allowPorts}, {cfg.DenyPorts, &f.denyPorts}} {
+		for _, spec := range list.specs {
+			lo, hi, err := config.ParsePortRange(spec)
+			if err != nil {
+				return nil, err
+			}
+			*list.dst = append(*list.dst, portRange{lo, hi})
+		}
+	}
+
+	return f, nil
+}
+
+// needsAddresses reports whether any address rule applies
+func (f *candidateFilter) needsAddresses() bool {
+	return !f.allowBogons || len(f.allowCIDRs) > 0 || len(f.denyCIDRs) > 0
+}
+
+// resolveHosts looks up the hostnames among candidates, so that names like
+// localhost or internal services are held to the same rules as addresses
+func (f *candidateFilter) resolveHosts(ctx context.Context, candidates []types.Candidate) {
+	if !f.needsAddresses() {
+		return
+	}
+
+	hosts := make(map[string]bool)
+	for _, candidate := range candidates {
+		host, _, err := net.SplitHostPort(candidate.Address)
+		if err != nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(host); err != nil {
+			hosts[strings.ToLower(host)] = true
+		}
+	}
+
+	f.resolved = make(map[string][]netip.Addr, len(hosts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, resolveConcurrency)
+	for host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			lookupCtx, cancel := context.WithTimeout(ctx, resolveTimeout)
+			defer cancel()
+			addrs, err := net.DefaultResolver.LookupNetIP(lookupCtx, "ip", host)
+			if err != nil {
+				log.Debugf("Cannot resolve candidate host %s: %v", host, err)
+				addrs = nil
+			}
+
+			mu.Lock()
+			f.resolved[host] = addrs
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+}
+
+// checkAddr applies the bogon and CIDR rules to one address
+func (f *candidateFilter) checkAddr(addr netip.Addr) string {
+	addr = addr.Unmap().WithZone("")
+	if !f.allowBogons && inPrefixes(addr, bogonPrefixes) {
+		return DropBogon
+	}
+	if inPrefixes(addr, f.denyCIDRs) {
+		return DropDeniedCIDR
+	}
+	if len(f.allowCIDRs) > 0 && !inPrefixes(addr, f.allowCIDRs) {
+		return DropNotAllowedCIDR
+	}
+	return ""
+}
+
+// check returns why a candidate is dropped, or "" to keep it. A hostname
+// is kept only if every address it resolves to passes the address rules;
+// one that does not resolve is dropped while any address rule applies.
+func (f *candidateFilter) check(candidate types.Candidate) string {
+	host, portStr, err := net.SplitHostPort(candidate.Address)
+	if err != nil {
+		return DropInvalid
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return DropInvalid
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if reason := f.checkAddr(addr); reason != "" {
+			return reason
+		}
+	} else if f.needsAddresses() {
+		addrs := f.resolved[strings.ToLower(host)]
+		if len(addrs) == 0 {
+			return DropUnresolved
+		}
+		for _, addr := range addrs {
+			if reason := f.checkAddr(addr); reason != "" {
+				return reason
+			}
+		}
+	}
+
+	if inPortRanges(port, f.denyPorts) {
+		return DropDeniedPort
+	}
+	if len(f.allowPorts) > 0 && !inPortRanges(port, f.allowPorts) {
+		return DropNotAllowedPort
+	}
+	return ""
+}
+
+func inPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func inPortRanges(port int, ranges []portRange) bool {
+	for _, r := range ranges {
+		if port >= r.lo && port <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter drops candidates excluded by the bogon, CIDR and port rules of
+// aggregator.filter and returns the rest with the dropped count per reason
+func (a *Aggregator) Filter(ctx context.Context, candidates []types.Candidate) ([]types.Candidate, map[string]int, error) {
+	f, err := a.compileFilter(ctx, candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := make([]types.Candidate, 0, len(candidates))
+	dropped := make(map[string]int)
+	for _, candidate := range candidates {
+		if reason := f.check(candidate); reason != "" {
+			dropped[reason]++
+			continue
+		}
+		kept = append(kept, candidate)
+	}
+
+	for reason, count := range dropped {
+		a.metrics.RecordCandidatesFiltered(reason, count)
+	}
+	if len(dropped) > 0 {
+		log.Infof("Filtered %d -> %d candidates: %v", len(candidates), len(kept), dropped)
+	}
+
+	return kept, dropped, nil
+}
+
+// FilterReason returns why the filter would drop a single candidate, or ""
+// if it passes. Unlike Filter it records no metrics.
+func (a *Aggregator) FilterReason(ctx context.Context, candidate types.Candidate) (string, error) {
+	f, err := a.compileFilter(ctx, []types.Candidate{candidate})
+	if err != nil {
+		return "", err
+	}
+	return f.check(candidate), nil
+}
+
+// CheckDialAddr applies the bogon and CIDR rules to an address about to be
+// dialed. Filtering vets a hostname candidate by resolving it, but the
+// checker resolves it again to connect and may get a different answer.
+func (a *Aggregator) CheckDialAddr(addr netip.Addr) error {
+	a.configMu.RLock()
+	cfg := a.config.Filter
+	a.configMu.RUnlock()
+
+	f, err := newCandidateFilter(cfg)
+	if err != nil {
+		return fmt.Errorf("compile filter: %w", err)
+	}
+	if reason := f.checkAddr(addr); reason != "" {
+		return fmt.Errorf("address %s rejected by filter: %s", addr, reason)
+	}
+	return nil
+}
+
+// compileFilter builds the current filter and resolves the hostnames among
+// candidates
+func (a *Aggregator) compileFilter(ctx context.Context, candidates []types.Candidate) (*candidateFilter, error) {
+	a.configMu.RLock()
+	cfg := a.config.Filter
+	a.configMu.RUnlock()
+
+	f, err := newCandidateFilter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("compile filter: %w", err)
+	}
+	f.resolveHosts(ctx, candidates)
+	return f, nil
+}
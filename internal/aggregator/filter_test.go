@@ -0,0 +1,179 @@
+package aggregator
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+func TestFilterCheck(t *testing.T) {
+	rules := config.FilterConfig{
+		DenyCIDRs:  []string{"45.0.0.0/8", "2001:4860::/32", "9.9.9.9"},
+		AllowCIDRs: []string{"0.0.0.0/0", "2000::/3"},
+		DenyPorts:  []string{"25", "6000-6999"},
+	}
+	allowOnly := config.FilterConfig{
+		AllowCIDRs: []string{"8.8.0.0/16"},
+		AllowPorts: []string{"80", "8000-8999"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.FilterConfig
+		address string
+		want    string
+	}{
+		{"public", config.FilterConfig{}, "8.8.8.8:80", ""},
+		{"private", config.FilterConfig{}, "10.1.2.3:80", DropBogon},
+		{"loopback", config.FilterConfig{}, "127.0.0.1:8080", DropBogon},
+		{"cgnat", config.FilterConfig{}, "100.64.0.1:80", DropBogon},
+		{"link-local", config.FilterConfig{}, "169.254.169.254:80", DropBogon},
+		{"documentation", config.FilterConfig{}, "203.0.113.5:80", DropBogon},
+		{"multicast", config.FilterConfig{}, "224.0.0.1:80", DropBogon},
+		{"reserved", config.FilterConfig{}, "255.255.255.255:80", DropBogon},
+		{"ipv6 loopback", config.FilterConfig{}, "[::1]:80", DropBogon},
+		{"ipv6 unique local", config.FilterConfig{}, "[fd00::1]:80", DropBogon},
+		{"ipv4-mapped private", config.FilterConfig{}, "[::ffff:192.168.1.1]:80", DropBogon},
+		{"public ipv6", config.FilterConfig{}, "[2606:4700::1]:443", ""},
+		{"bogon allowed", config.FilterConfig{AllowBogons: true}, "10.1.2.3:80", ""},
+
+		{"denied cidr", rules, "45.1.2.3:80", DropDeniedCIDR},
+		{"denied single address", rules, "9.9.9.9:80", DropDeniedCIDR},
+		{"denied ipv6 cidr", rules, "[2001:4860::8888]:80", DropDeniedCIDR},
+		{"bogon before cidr rules", rules, "10.0.0.1:80", DropBogon},
+		{"denied port", rules, "8.8.8.8:25", DropDeniedPort},
+		{"denied port range", rules, "8.8.8.8:6379", DropDeniedPort},
+		{"port past range", rules, "8.8.8.8:7000", ""},
+
+		{"allowed cidr and port", allowOnly, "8.8.4.4:8080", ""},
+		{"outside allowed cidr", allowOnly, "1.1.1.1:80", DropNotAllowedCIDR},
+		{"outside allowed ports", allowOnly, "8.8.4.4:3128", DropNotAllowedPort},
+
+		{"invalid address", config.FilterConfig{}, "8.8.8.8", DropInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newCandidateFilter(tt.cfg)
+			if err != nil {
+				t.Fatalf("newCandidateFilter: %v", err)
+			}
+			if got := f.check(types.Candidate{Address: tt.address}); got != tt.want {
+				t.Errorf("check(%s) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterCheckHostnames(t *testing.T) {
+	resolved := map[string][]netip.Addr{
+		"public.example":   {netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("2606:4700::1")},
+		"internal.example": {netip.MustParseAddr("10.0.0.5")},
+		"mixed.example":    {netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("127.0.0.1")},
+		"denied.example":   {netip.MustParseAddr("45.1.2.3")},
+		"missing.example":  nil,
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.FilterConfig
+		address string
+		want    string
+	}{
+		{"public", config.FilterConfig{}, "public.example:80", ""},
+		{"internal", config.FilterConfig{}, "internal.example:80", DropBogon},
+		{"any address internal", config.FilterConfig{}, "mixed.example:80", DropBogon},
+		{"unresolved", config.FilterConfig{}, "missing.example:80", DropUnresolved},
+		{"denied cidr", config.FilterConfig{DenyCIDRs: []string{"45.0.0.0/8"}}, "denied.example:80", DropDeniedCIDR},
+		// Without address rules hostnames are not resolved at all
+		{"no address rules", config.FilterConfig{AllowBogons: true}, "missing.example:80", ""},
+		{"port rules still apply", config.FilterConfig{AllowBogons: true, DenyPorts: []string{"80"}},
+			"missing.example:80", DropDeniedPort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newCandidateFilter(tt.cfg)
+			if err != nil {
+				t.Fatalf("newCandidateFilter: %v", err)
+			}
+			if f.needsAddresses() {
+				f.resolved = resolved
+			}
+			if got := f.check(types.Candidate{Address: tt.address}); got != tt.want {
+				t.Errorf("check(%s) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCandidateFilterInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.FilterConfig
+	}{
+		{"bad cidr", config.FilterConfig{DenyCIDRs: []string{"10.0.0.0/33"}}},
+		{"bad address", config.FilterConfig{AllowCIDRs: []string{"10.0.0"}}},
+		{"port zero", config.FilterConfig{DenyPorts: []string{"0"}}},
+		{"reversed range", config.FilterConfig{AllowPorts: []string{"90-80"}}},
+		{"port out of range", config.FilterConfig{AllowPorts: []string{"65536"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newCandidateFilter(tt.cfg); err == nil {
+				t.Errorf("newCandidateFilter(%+v) succeeded, want error", tt.cfg)
+			}
+		})
+	}
+}
+
+func TestFilterCounts(t *testing.T) {
+	a := NewAggregator(config.AggregatorConfig{
+		Filter: config.FilterConfig{DenyPorts: []string{"25"}},
+	}, testMetrics)
+
+	candidates := []types.Candidate{
+		{Address: "8.8.8.8:80"},
+		{Address: "10.0.0.1:80"},
+		{Address: "192.168.1.1:80"},
+		{Address: "8.8.4.4:25"},
+		{Address: "1.1.1.1:3128"},
+	}
+	kept, dropped, err := a.Filter(context.Background(), candidates)
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	assertCandidates(t, kept, []types.Candidate{{Address: "8.8.8.8:80"}, {Address: "1.1.1.1:3128"}})
+	if dropped[DropBogon] != 2 || dropped[DropDeniedPort] != 1 || len(dropped) != 2 {
+		t.Errorf("dropped = %v, want 2 bogon and 1 denied_port", dropped)
+	}
+}
+
+func TestCheckDialAddr(t *testing.T) {
+	a := NewAggregator(config.AggregatorConfig{
+		Filter: config.FilterConfig{DenyCIDRs: []string{"45.0.0.0/8"}},
+	}, testMetrics)
+
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"8.8.8.8", false},
+		{"127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"45.1.2.3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := a.CheckDialAddr(netip.MustParseAddr(tt.addr))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckDialAddr(%s) = %v, want error %t", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
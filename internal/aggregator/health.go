@@ -0,0 +1,245 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const healthBlobName = "source_health"
+
+// SourceHealth tracks how well a source has been doing across cycles
+type SourceHealth struct {
+	URL                 string     `json:"url"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	BackoffUntil        *time.Time `json:"backoff_until,omitempty"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"` // set when disabled automatically, until re-enabled
+
+	// Yield of the last checked cycle: alive proxies contributed / found
+	ProxiesFound int     `json:"proxies_found"`
+	ProxiesAlive int     `json:"proxies_alive"`
+	Yield        float64 `json:"yield"`
+}
+
+// Health returns a copy of the health state of every tracked source
+func (a *Aggregator) Health() map[string]SourceHealth {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	health := make(map[string]SourceHealth, len(a.health))
+	for name, h := range a.health {
+		health[name] = *h
+	}
+	return health
+}
+
+func (a *Aggregator) healthSettings() (maxBackoff time.Duration, disableAfter int, interval time.Duration) {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return time.Duration(a.config.MaxBackoffSeconds) * time.Second,
+		a.config.DisableAfterFailures,
+		time.Duration(a.config.IntervalSeconds) * time.Second
+}
+
+// backingOff reports whether a source is waiting out a failure backoff
+func (a *Aggregator) backingOff(name string, now time.Time) (time.Time, bool) {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	if h, ok := a.health[name]; ok && h.BackoffUntil != nil && now.Before(*h.BackoffUntil) {
+		return *h.BackoffUntil, true
+	}
+	return time.Time{}, false
+}
+
+// autoDisabledLocked reports whether a source was disabled after repeated
+// failures. The source itself stays enabled in the source list, so the
+// state lives in (and is persisted with) its health record.
+func (a *Aggregator) autoDisabledLocked(name string) bool {
+	h, ok := a.health[name]
+	return ok && h.DisabledAt != nil
+}
+
+// recordFetch updates a source's health after a fetch and disables it once
+// it crosses disable_after_failures
+func (a *Aggregator) recordFetch(source config.Source, err error) {
+	maxBackoff, disableAfter, interval := a.healthSettings()
+	now := time.Now()
+
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	h := a.healthLocked(source)
+
+	if err == nil {
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = &now
+		h.LastError = ""
+		h.BackoffUntil = nil
+		a.metrics.SetSourceHealth(source.Name, true, 0)
+		return
+	}
+
+	h.ConsecutiveFailures++
+	h.LastFailure = &now
+	h.LastError = err.Error()
+	a.metrics.SetSourceHealth(source.Name, false, h.ConsecutiveFailures)
+
+	// The first failure keeps the normal cadence; each further one doubles
+	// the wait, up to max_backoff_seconds
+	if h.ConsecutiveFailures > 1 {
+		delay := interval
+		for i := 1; i < h.ConsecutiveFailures && delay < maxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+		until := now.Add(delay)
+		h.BackoffUntil = &until
+	}
+
+	if disableAfter > 0 && h.ConsecutiveFailures >= disableAfter && h.DisabledAt == nil {
+		h.DisabledAt = &now
+		log.Warnf("Source %s disabled after %d consecutive failures", source.Name, h.ConsecutiveFailures)
+	}
+}
+
+// RecordYield counts, per source, the checked candidates it listed and how
+// many of them are alive, updates the health records and gauges, and
+// returns the counts
+func (a *Aggregator) RecordYield(checked, alive []types.Candidate) map[string]types.SourceYield {
+	counts := make(map[string]types.SourceYield)
+	for _, candidate := range checked {
+		for _, source := range sourceNames(candidate.Sources) {
+			y := counts[source]
+			y.Found++
+			counts[source] = y
+		}
+	}
+	for _, candidate := range alive {
+		for _, source := range sourceNames(candidate.Sources) {
+			y := counts[source]
+			y.Alive++
+			counts[source] = y
+		}
+	}
+
+	a.metrics.ResetSourceYield()
+	for source, y := range counts {
+		if y.Found > 0 {
+			y.Yield = float64(y.Alive) / float64(y.Found)
+		}
+		counts[source] = y
+		a.metrics.SetSourceYield(source, y.Alive, y.Yield)
+	}
+
+	a.healthMu.Lock()
+	for name, h := range a.health {
+		y := counts[name]
+		h.ProxiesFound, h.ProxiesAlive, h.Yield = y.Found, y.Alive, y.Yield
+	}
+	a.healthMu.Unlock()
+
+	a.persistHealth()
+	return counts
+}
+
+// sourceNames returns the distinct source names of a provenance list, so a
+// proxy listed by several entries of one archive counts once
+func sourceNames(provenance []string) []string {
+	names := make([]string, 0, len(provenance))
+	for _, item := range provenance {
+		name := types.SourceName(item)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// healthLocked returns the health record of source, creating it if needed
+func (a *Aggregator) healthLocked(source config.Source) *SourceHealth {
+	h, ok := a.health[source.Name]
+	if !ok {
+		h = &SourceHealth{}
+		a.health[source.Name] = h
+	}
+	h.URL = source.URL
+	return h
+}
+
+// resetHealth forgets a source's failures, e.g. when it is re-enabled
+func (a *Aggregator) resetHealth(name string) {
+	a.healthMu.Lock()
+	delete(a.health, name)
+	a.healthMu.Unlock()
+	a.metrics.DeleteSource(name)
+}
+
+// pruneHealth drops the state of sources that no longer exist
+func (a *Aggregator) pruneHealth(sources []config.Source) {
+	names := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		names[source.Name] = true
+	}
+
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+	for name := range a.health {
+		if !names[name] {
+			delete(a.health, name)
+			a.metrics.DeleteSource(name)
+		}
+	}
+}
+
+func (a *Aggregator) loadHealth() error {
+	if a.store == nil {
+		return nil
+	}
+
+	data, err := a.store.LoadBlob(healthBlobName)
+	if err != nil || data == nil {
+		return err
+	}
+
+	health := make(map[string]*SourceHealth)
+	if err := json.Unmarshal(data, &health); err != nil {
+		return fmt.Errorf("parse source health: %w", err)
+	}
+
+	a.healthMu.Lock()
+	a.health = health
+	a.healthMu.Unlock()
+	return nil
+}
+
+func (a *Aggregator) persistHealth() {
+	a.sourcesMu.RLock()
+	store := a.store
+	a.sourcesMu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	a.healthMu.Lock()
+	data, err := json.Marshal(a.health)
+	a.healthMu.Unlock()
+	if err != nil {
+		log.Errorf("Failed to marshal source health: %v", err)
+		return
+	}
+
+	if err := store.SaveBlob(healthBlobName, data); err != nil {
+		log.Errorf("Failed to persist source health: %v", err)
+	}
+}
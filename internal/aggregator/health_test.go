@@ -0,0 +1,171 @@
+package aggregator
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/metrics"
+	"github.com/proxy-checker-api/internal/storage"
+)
+
+// testMetrics is shared because collectors register globally
+var testMetrics = metrics.NewCollector("aggregator_test")
+
+func newHealthAggregator(t *testing.T, store storage.Storage, cfg config.AggregatorConfig) *Aggregator {
+	t.Helper()
+	a := NewAggregator(cfg, testMetrics)
+	if store != nil {
+		if err := a.EnablePersistence(store); err != nil {
+			t.Fatalf("EnablePersistence: %v", err)
+		}
+	}
+	return a
+}
+
+func activeNames(a *Aggregator) []string {
+	var names []string
+	for _, source := range a.activeSources() {
+		names = append(names, source.Name)
+	}
+	return names
+}
+
+func TestAutoDisableKeepsSourceList(t *testing.T) {
+	store, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.AggregatorConfig{
+		IntervalSeconds:      60,
+		MaxBackoffSeconds:    3600,
+		DisableAfterFailures: 2,
+		Sources: []config.Source{
+			{Name: "flaky", URL: "http://flaky.example/list.txt", Type: "txt", Enabled: true},
+			{Name: "steady", URL: "http://steady.example/list.txt", Type: "txt", Enabled: true},
+		},
+	}
+
+	a := newHealthAggregator(t, store, cfg)
+	flaky := cfg.Sources[0]
+	for i := 0; i < 2; i++ {
+		a.recordFetch(flaky, errors.New("connection refused"))
+	}
+	a.persistHealth()
+
+	if got := activeNames(a); len(got) != 1 || got[0] != "steady" {
+		t.Fatalf("active sources after auto-disable = %v, want [steady]", got)
+	}
+	if data, err := store.LoadBlob(sourcesBlobName); err != nil || data != nil {
+		t.Fatalf("source list persisted by auto-disable: %s, %v", data, err)
+	}
+
+	// The disable survives a restart, and config.json still supplies the list
+	restarted := newHealthAggregator(t, store, cfg)
+	if got := activeNames(restarted); len(got) != 1 || got[0] != "steady" {
+		t.Fatalf("active sources after restart = %v, want [steady]", got)
+	}
+	if h := restarted.Health()["flaky"]; h.DisabledAt == nil {
+		t.Fatal("disabled_at lost on restart")
+	}
+
+	// Re-enabling through the admin API clears the health record
+	if _, err := restarted.UpdateSource("flaky", func(src *config.Source) { src.Enabled = true }); err != nil {
+		t.Fatalf("UpdateSource: %v", err)
+	}
+	if got := activeNames(restarted); len(got) != 2 {
+		t.Fatalf("active sources after re-enable = %v, want both", got)
+	}
+	if _, ok := restarted.Health()["flaky"]; ok {
+		t.Error("health of re-enabled source not reset")
+	}
+}
+
+func TestRecordFetchBackoff(t *testing.T) {
+	cfg := config.AggregatorConfig{
+		IntervalSeconds:      60,
+		MaxBackoffSeconds:    600,
+		DisableAfterFailures: -1,
+	}
+	source := config.Source{Name: "flaky", URL: "http://flaky.example/list.txt", Type: "txt", Enabled: true}
+
+	tests := []struct {
+		failures int
+		want     time.Duration // 0: no backoff
+	}{
+		{1, 0}, // the first failure keeps the normal cadence
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute}, // capped at max_backoff_seconds
+		{30, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d failures", tt.failures), func(t *testing.T) {
+			a := newHealthAggregator(t, nil, cfg)
+			var before time.Time
+			for i := 0; i < tt.failures; i++ {
+				before = time.Now()
+				a.recordFetch(source, errors.New("timeout"))
+			}
+
+			h := a.Health()[source.Name]
+			if h.ConsecutiveFailures != tt.failures {
+				t.Errorf("ConsecutiveFailures = %d, want %d", h.ConsecutiveFailures, tt.failures)
+			}
+			if tt.want == 0 {
+				if h.BackoffUntil != nil {
+					t.Errorf("backoff until %v, want none", h.BackoffUntil)
+				}
+				return
+			}
+			if h.BackoffUntil == nil {
+				t.Fatalf("no backoff, want %v", tt.want)
+			}
+			if got := h.BackoffUntil.Sub(before); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("backoff %v, want %v", got, tt.want)
+			}
+			if _, ok := a.backingOff(source.Name, time.Now()); !ok {
+				t.Error("backingOff = false")
+			}
+		})
+	}
+}
+
+func TestRecordFetchSuccessResets(t *testing.T) {
+	a := newHealthAggregator(t, nil, config.AggregatorConfig{
+		IntervalSeconds:      60,
+		MaxBackoffSeconds:    3600,
+		DisableAfterFailures: 3,
+	})
+	source := config.Source{Name: "flaky", URL: "http://flaky.example/list.txt", Type: "txt", Enabled: true}
+
+	for i := 0; i < 2; i++ {
+		a.recordFetch(source, errors.New("timeout"))
+	}
+	a.recordFetch(source, nil)
+
+	h := a.Health()[source.Name]
+	if h.ConsecutiveFailures != 0 || h.BackoffUntil != nil || h.LastError != "" || h.LastSuccess == nil {
+		t.Errorf("health after success = %+v, want failures cleared", h)
+	}
+	if _, ok := a.backingOff(source.Name, time.Now()); ok {
+		t.Error("still backing off after a success")
+	}
+
+	// The disable threshold counts consecutive failures only
+	for i := 0; i < 2; i++ {
+		a.recordFetch(source, errors.New("timeout"))
+	}
+	if h := a.Health()[source.Name]; h.DisabledAt != nil {
+		t.Error("disabled before disable_after_failures consecutive failures")
+	}
+	a.recordFetch(source, errors.New("timeout"))
+	if h := a.Health()[source.Name]; h.DisabledAt == nil {
+		t.Error("not disabled after disable_after_failures consecutive failures")
+	}
+}
@@ -0,0 +1,272 @@
+package aggregator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Ingest body formats
+const (
+	IngestText   = "text"
+	IngestJSON   = "json"
+	IngestNDJSON = "ndjson"
+)
+
+// ingestURLPrefix marks virtual sources in source stats
+const ingestURLPrefix = "ingest://"
+
+var ingestNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// ErrTooManyIngestSources is returned when a push would open a virtual
+// source beyond max_sources
+var ErrTooManyIngestSources = errors.New("too many ingest sources")
+
+// IngestResult reports what happened to pushed candidates
+type IngestResult struct {
+	Accepted  int `json:"accepted"`  // new candidates queued for checking
+	Refreshed int `json:"refreshed"` // already queued under this source; retention extended
+	InPool    int `json:"in_pool"`   // already alive in the current pool
+	Dropped   int `json:"dropped"`   // the source reached max_per_source
+	Retained  int `json:"retained"`  // candidates now held by the source
+}
+
+type ingestEntry struct {
+	candidate types.Candidate
+	seen      time.Time
+}
+
+// ingestRecord is one JSON/NDJSON record. A bare string is also accepted.
+type ingestRecord struct {
+	Address  string      `json:"address"`
+	IP       string      `json:"ip"`
+	Port     json.Number `json:"port"`
+	Protocol string      `json:"protocol"`
+	Country  string      `json:"country"`
+	Username string      `json:"username"`
+	Password string      `json:"password"`
+}
+
+// IngestConfig returns the current push ingestion limits
+func (a *Aggregator) IngestConfig() config.IngestConfig {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config.Ingest
+}
+
+// ValidIngestSource reports whether name can be used as a virtual source
+func ValidIngestSource(name string) bool {
+	return ingestNameRegex.MatchString(name)
+}
+
+// Ingest queues pushed candidates under the virtual source name. They are
+// checked with every cycle until retention_minutes pass without them being
+// pushed again. inPool reports candidates already alive in the served pool,
+// which are not queued. A new source beyond max_sources is refused with
+// ErrTooManyIngestSources.
+func (a *Aggregator) Ingest(source string, candidates []types.Candidate, inPool func(types.Candidate) bool) (IngestResult, error) {
+	cfg := a.IngestConfig()
+	now := time.Now()
+
+	a.ingestMu.Lock()
+	defer a.ingestMu.Unlock()
+
+	a.expireIngestedLocked(now, cfg)
+
+	entries, ok := a.ingested[source]
+	if !ok {
+		if len(a.ingested) >= cfg.MaxSources {
+			return IngestResult{}, ErrTooManyIngestSources
+		}
+		entries = make(map[string]*ingestEntry)
+		a.ingested[source] = entries
+	}
+
+	var result IngestResult
+	for _, candidate := range deduplicateProxies(candidates) {
+		key := candidate.Key()
+		if entry, exists := entries[key]; exists {
+			entry.seen = now
+			result.Refreshed++
+			continue
+		}
+		if inPool != nil && inPool(candidate) {
+			result.InPool++
+			continue
+		}
+		if len(entries) >= cfg.MaxPerSource {
+			result.Dropped++
+			continue
+		}
+		entries[key] = &ingestEntry{candidate: candidate, seen: now}
+		result.Accepted++
+	}
+	result.Retained = len(entries)
+
+	if len(entries) == 0 {
+		delete(a.ingested, source)
+	}
+
+	log.Infof("Ingest %s: %d accepted, %d refreshed, %d in pool, %d dropped",
+		source, result.Accepted, result.Refreshed, result.InPool, result.Dropped)
+	return result, nil
+}
+
+// ingestSources returns the names of the virtual sources holding candidates
+func (a *Aggregator) ingestSources() []string {
+	cfg := a.IngestConfig()
+
+	a.ingestMu.Lock()
+	defer a.ingestMu.Unlock()
+
+	a.expireIngestedLocked(time.Now(), cfg)
+
+	names := make([]string, 0, len(a.ingested))
+	for name := range a.ingested {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ingestProvider serves the candidates retained for a virtual source
+type ingestProvider struct {
+	a    *Aggregator
+	name string
+}
+
+func (a *Aggregator) newIngestProvider(source config.Source) (SourceProvider, error) {
+	name := strings.TrimPrefix(source.URL, ingestURLPrefix)
+	if !ValidIngestSource(name) {
+		return nil, fmt.Errorf("invalid ingest source %q", source.URL)
+	}
+	return ingestProvider{a: a, name: name}, nil
+}
+
+func (p ingestProvider) Fetch(ctx context.Context) ([]types.Candidate, error) {
+	cfg := p.a.IngestConfig()
+
+	p.a.ingestMu.Lock()
+	defer p.a.ingestMu.Unlock()
+
+	p.a.expireIngestedLocked(time.Now(), cfg)
+
+	entries := p.a.ingested[p.name]
+	candidates := make([]types.Candidate, 0, len(entries))
+	for _, entry := range entries {
+		candidates = append(candidates, entry.candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Key() < candidates[j].Key() })
+	return candidates, nil
+}
+
+func (a *Aggregator) expireIngestedLocked(now time.Time, cfg config.IngestConfig) {
+	cutoff := now.Add(-time.Duration(cfg.RetentionMinutes) * time.Minute)
+	for name, entries := range a.ingested {
+		for key, entry := range entries {
+			if entry.seen.Before(cutoff) {
+				delete(entries, key)
+			}
+		}
+		if len(entries) == 0 {
+			delete(a.ingested, name)
+		}
+	}
+}
+
+// ParseIngest parses a pushed body. Text bodies use the same rules as txt
+// sources; JSON bodies are an array (or {"proxies": [...]}) of address
+// strings or records; NDJSON bodies hold one string or record per line.
+func ParseIngest(r io.Reader, format string) ([]types.Candidate, error) {
+	switch format {
+	case IngestText:
+		return parseProxies(r)
+	case IngestJSON:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		data = bytes.TrimSpace(data)
+
+		var raw []json.RawMessage
+		if len(data) > 0 && data[0] == '{' {
+			var wrapper struct {
+				Proxies []json.RawMessage `json:"proxies"`
+			}
+			if err := json.Unmarshal(data, &wrapper); err != nil {
+				return nil, fmt.Errorf("decode JSON: %w", err)
+			}
+			raw = wrapper.Proxies
+		} else if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("decode JSON: %w", err)
+		}
+
+		proxies := make([]types.Candidate, 0, len(raw))
+		for i, item := range raw {
+			candidate, ok, err := parseIngestRecord(item)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", i, err)
+			}
+			if ok {
+				proxies = append(proxies, candidate)
+			}
+		}
+		return proxies, nil
+	case IngestNDJSON:
+		proxies := make([]types.Candidate, 0)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			candidate, ok, err := parseIngestRecord(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if ok {
+				proxies = append(proxies, candidate)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return proxies, fmt.Errorf("scan: %w", err)
+		}
+		return proxies, nil
+	default:
+		return nil, fmt.Errorf("unknown ingest format %q", format)
+	}
+}
+
+// parseIngestRecord decodes one record. Malformed JSON is an error; a
+// well-formed record that is not a valid proxy is skipped.
+func parseIngestRecord(data []byte) (types.Candidate, bool, error) {
+	var address string
+	if err := json.Unmarshal(data, &address); err == nil {
+		candidate, ok := ParseProxyAddress(address)
+		return candidate, ok, nil
+	}
+
+	var record ingestRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return types.Candidate{}, false, err
+	}
+
+	candidate, ok := buildCandidate(record.IP, record.Port.String(), record.Address,
+		record.Protocol, record.Country, record.Username, record.Password)
+	return candidate, ok, nil
+}
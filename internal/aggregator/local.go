@@ -0,0 +1,271 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	stdinOnce sync.Once
+	stdinData []byte
+	stdinErr  error
+)
+
+// localPath returns the filesystem path (or glob pattern) of a file:// URL.
+// Both file:///abs/path and file://relative/path are accepted.
+func localPath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	path := u.Host + u.Path
+	if path == "" {
+		return "", fmt.Errorf("empty file path")
+	}
+	return filepath.Clean(path), nil
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// localFiles resolves a file:// source to the regular files it covers: the
+// file itself, every non-hidden file in a directory, or the glob matches
+func localFiles(path string) ([]string, error) {
+	if hasGlobMeta(path) {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("glob: %w", err)
+		}
+		files := make([]string, 0, len(matches))
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				files = append(files, match)
+			}
+		}
+		return files, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("read directory: %w", err)
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// fileProvider reads every file covered by a file:// source
+type fileProvider struct {
+	a      *Aggregator
+	source config.Source
+	path   string
+}
+
+func (a *Aggregator) newFileProvider(source config.Source) (SourceProvider, error) {
+	path, err := localPath(source.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL %q: %w", source.URL, err)
+	}
+	return fileProvider{a: a, source: source, path: path}, nil
+}
+
+func (p fileProvider) Fetch(ctx context.Context) ([]types.Candidate, error) {
+	files, err := localFiles(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]types.Candidate, 0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return proxies, fmt.Errorf("open %s: %w", file, err)
+		}
+		found, err := p.a.parsePayload(io.LimitReader(f, bodyLimit(p.source)), p.source)
+		f.Close()
+		if err != nil {
+			return proxies, fmt.Errorf("parse %s: %w", file, err)
+		}
+		proxies = append(proxies, found...)
+	}
+
+	return proxies, nil
+}
+
+// stdinProvider parses standard input. Stdin can only be consumed once, so
+// it is read fully on first use and the same content is reused every cycle.
+type stdinProvider struct {
+	a      *Aggregator
+	source config.Source
+}
+
+func (a *Aggregator) newStdinProvider(source config.Source) (SourceProvider, error) {
+	return stdinProvider{a: a, source: source}, nil
+}
+
+func (p stdinProvider) Fetch(ctx context.Context) ([]types.Candidate, error) {
+	stdinOnce.Do(func() {
+		stdinData, stdinErr = io.ReadAll(io.LimitReader(os.Stdin, bodyLimit(p.source)))
+		if stdinErr == nil {
+			log.Infof("Read %d bytes of proxies from stdin", len(stdinData))
+		}
+	})
+	if stdinErr != nil {
+		return nil, fmt.Errorf("read stdin: %w", stdinErr)
+	}
+
+	return p.a.parsePayload(bytes.NewReader(stdinData), p.source)
+}
+
+// WatchLocalSources calls onChange with the source name whenever a file
+// covered by an enabled file:// source with "watch": true changes. The
+// watch set follows source list edits until ctx is done.
+func (a *Aggregator) WatchLocalSources(ctx context.Context, onChange func(source string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+
+	a.watchMu.Lock()
+	a.watcher = watcher
+	a.watchMu.Unlock()
+	a.refreshWatches()
+
+	go func() {
+		defer watcher.Close()
+
+		const debounce = time.Second
+		pending := make(map[string]bool)
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				a.watchMu.Lock()
+				a.watcher = nil
+				a.watchMu.Unlock()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				for _, name := range a.sourcesWatching(event.Name) {
+					pending[name] = true
+					timer.Reset(debounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("Source watcher error: %v", err)
+			case <-timer.C:
+				for name := range pending {
+					log.Infof("Local source %s changed", name)
+					a.markDue(name)
+					onChange(name)
+				}
+				pending = make(map[string]bool)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchDirs maps each directory to watch to the sources interested in it
+func (a *Aggregator) watchDirs() map[string][]config.Source {
+	dirs := make(map[string][]config.Source)
+	for _, source := range a.activeSources() {
+		if !source.Watch || !strings.HasPrefix(source.URL, "file:") {
+			continue
+		}
+		path, err := localPath(source.URL)
+		if err != nil {
+			continue
+		}
+
+		dir := path
+		if hasGlobMeta(path) {
+			dir = filepath.Dir(path)
+		} else if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		dirs[dir] = append(dirs[dir], source)
+	}
+	return dirs
+}
+
+// refreshWatches aligns the watched directories with the current sources
+func (a *Aggregator) refreshWatches() {
+	a.watchMu.Lock()
+	defer a.watchMu.Unlock()
+
+	if a.watcher == nil {
+		return
+	}
+
+	wanted := a.watchDirs()
+	for _, dir := range a.watcher.WatchList() {
+		if _, ok := wanted[dir]; !ok {
+			a.watcher.Remove(dir)
+		}
+	}
+	for dir := range wanted {
+		if err := a.watcher.Add(dir); err != nil {
+			log.Warnf("Cannot watch %s: %v", dir, err)
+		}
+	}
+}
+
+// sourcesWatching returns the watched sources that cover path
+func (a *Aggregator) sourcesWatching(path string) []string {
+	var names []string
+	for dir, sources := range a.watchDirs() {
+		if filepath.Dir(path) != dir {
+			continue
+		}
+		for _, source := range sources {
+			sourcePath, _ := localPath(source.URL)
+			switch {
+			case hasGlobMeta(sourcePath):
+				if ok, _ := filepath.Match(sourcePath, path); ok {
+					names = append(names, source.Name)
+				}
+			case sourcePath == dir:
+				if !strings.HasPrefix(filepath.Base(path), ".") {
+					names = append(names, source.Name)
+				}
+			case sourcePath == path:
+				names = append(names, source.Name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,208 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMaxPages = 10
+
+// fetchPages crawls a paginated source and merges its pages. It stops at
+// max_pages, at a page that adds no new proxies (an empty page, or an API
+// that ignores the page parameter) or when there is no next page. Next
+// pages on another scheme or host are not followed, since every page is
+// requested with the source's headers and auth. A failed page fails the
+// whole fetch.
+func (a *Aggregator) fetchPages(ctx context.Context, source config.Source) (httpResult, error) {
+	p := *source.Pagination
+
+	maxPages := p.MaxPages
+	if maxPages == 0 {
+		maxPages = defaultMaxPages
+	}
+	param := p.Param
+	if param == "" {
+		param = p.Type
+	}
+	page := 1
+	if p.Start != nil {
+		page = *p.Start
+	}
+
+	pageURL := source.URL
+	if p.Type == "page" {
+		pageURL = withQuery(source.URL, param, strconv.Itoa(page))
+	}
+
+	seen := make(map[string]bool)
+	proxies := make([]types.Candidate, 0)
+	pages := 0
+
+	for pageURL != "" {
+		if pages == maxPages {
+			log.Infof("Source %s: stopped after max_pages (%d)", source.URL, maxPages)
+			break
+		}
+		if pages > 0 && p.DelayMs > 0 {
+			timer := time.NewTimer(time.Duration(p.DelayMs) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return httpResult{}, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		result, err := a.fetchPage(ctx, source, pageURL, nil)
+		if err != nil {
+			return httpResult{}, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+		pages++
+
+		added := 0
+		for _, candidate := range result.proxies {
+			if key := candidate.Key(); !seen[key] {
+				seen[key] = true
+				proxies = append(proxies, candidate)
+				added++
+			}
+		}
+		if added == 0 {
+			break
+		}
+
+		switch p.Type {
+		case "page":
+			page++
+			pageURL = withQuery(source.URL, param, strconv.Itoa(page))
+		default:
+			pageURL = result.next
+			if pageURL != "" && !sameOrigin(source.URL, pageURL) {
+				log.Warnf("Source %s: not following next page on another host: %s", source.URL, pageURL)
+				pageURL = ""
+			}
+		}
+	}
+
+	log.Debugf("Source %s: crawled %d pages", source.URL, pages)
+	return httpResult{proxies: proxies, pages: pages}, nil
+}
+
+// nextLink returns the rel="next" target of RFC 8288 Link headers,
+// resolved against the page URL
+func nextLink(base *url.URL, headers []string) string {
+	for _, header := range headers {
+		for {
+			start := strings.IndexByte(header, '<')
+			end := strings.IndexByte(header, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target := header[start+1 : end]
+			params := header[end+1:]
+			header = ""
+			if i := strings.IndexByte(params, '<'); i >= 0 {
+				params, header = params[:i], params[i:]
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, "\" ,")) {
+					if strings.EqualFold(rel, "next") {
+						return resolvePage(base, target)
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// nextCursorPage reads the cursor field of a JSON page. A cursor that looks
+// like a URL is followed as is; any other value is sent in the cursor
+// parameter. An empty or missing cursor ends the crawl.
+func nextCursorPage(base *url.URL, data []byte, p config.Pagination) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("decode cursor: %w", err)
+	}
+
+	values := selectPath(doc, p.CursorField)
+	if len(values) == 0 {
+		return "", nil
+	}
+	cursor := scalarString(values[0])
+
+	switch {
+	case cursor == "":
+		return "", nil
+	case strings.HasPrefix(cursor, "http://"), strings.HasPrefix(cursor, "https://"),
+		strings.HasPrefix(cursor, "/"), strings.HasPrefix(cursor, "?"):
+		return resolvePage(base, cursor), nil
+	}
+
+	param := p.Param
+	if param == "" {
+		param = "cursor"
+	}
+	return withQuery(base.String(), param, cursor), nil
+}
+
+func resolvePage(base *url.URL, ref string) string {
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+// sameOrigin reports whether both URLs have the same scheme, host and port
+func sameOrigin(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Hostname(), ub.Hostname()) &&
+		originPort(ua) == originPort(ub)
+}
+
+// originPort returns the URL's port, or the default port of its scheme
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// withQuery sets one query parameter of rawURL
+func withQuery(rawURL, param, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set(param, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
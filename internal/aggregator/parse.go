@@ -0,0 +1,395 @@
+package aggregator
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	"golang.org/x/net/html"
+)
+
+// parseSource dispatches on the source type
+func parseSource(r io.Reader, source config.Source) ([]types.Candidate, error) {
+	switch source.Type {
+	case "", "txt":
+		return parseProxies(r)
+	case "json":
+		if source.JSON == nil {
+			return nil, fmt.Errorf("missing json format settings")
+		}
+		return parseJSON(r, *source.JSON)
+	case "csv", "tsv":
+		format := config.TableFormat{}
+		if source.CSV != nil {
+			format = *source.CSV
+		}
+		if format.Delimiter == "" {
+			format.Delimiter = ","
+			if source.Type == "tsv" {
+				format.Delimiter = "\t"
+			}
+		}
+		return parseCSV(r, format)
+	case "html":
+		if source.HTML == nil {
+			return nil, fmt.Errorf("missing html format settings")
+		}
+		return parseHTMLTable(r, *source.HTML)
+	default:
+		return nil, fmt.Errorf("unknown source type %q", source.Type)
+	}
+}
+
+func parseProxies(r io.Reader) ([]types.Candidate, error) {
+	proxies := make([]types.Candidate, 0)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if candidate, ok := findProxyAddress(line); ok {
+			proxies = append(proxies, candidate)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return proxies, fmt.Errorf("scan: %w", err)
+	}
+
+	return proxies, nil
+}
+
+// parseJSON extracts candidates from a JSON document using the configured
+// record selector and field mapping
+func parseJSON(r io.Reader, format config.JSONFormat) ([]types.Candidate, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode JSON: %w", err)
+	}
+
+	records := selectPath(doc, format.Records)
+	// A selector that lands on an array means "its elements"
+	if len(records) == 1 {
+		if arr, ok := records[0].([]interface{}); ok {
+			records = arr
+		}
+	}
+
+	proxies := make([]types.Candidate, 0, len(records))
+	fields := format.Fields
+
+	for _, record := range records {
+		get := func(selector string) string {
+			if selector == "" {
+				return ""
+			}
+			values := selectPath(record, selector)
+			if len(values) == 0 {
+				return ""
+			}
+			return scalarString(values[0])
+		}
+
+		if candidate, ok := buildCandidate(get(fields.IP), get(fields.Port), get(fields.Address),
+			get(fields.Protocol), get(fields.Country), get(fields.Username), get(fields.Password)); ok {
+			proxies = append(proxies, candidate)
+		}
+	}
+
+	return proxies, nil
+}
+
+// parseCSV extracts candidates from delimited text
+func parseCSV(r io.Reader, format config.TableFormat) ([]types.Candidate, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = []rune(format.Delimiter)[0]
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse CSV: %w", err)
+	}
+
+	return parseTable(rows, format)
+}
+
+// parseHTMLTable extracts candidates from the table_index-th <table> of an
+// HTML page
+func parseHTMLTable(r io.Reader, format config.TableFormat) ([]types.Candidate, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse HTML: %w", err)
+	}
+
+	tables := findElements(doc, "table")
+	if format.TableIndex < 0 || format.TableIndex >= len(tables) {
+		return nil, fmt.Errorf("table %d not found (page has %d tables)", format.TableIndex, len(tables))
+	}
+
+	var rows [][]string
+	for _, tr := range findElements(tables[format.TableIndex], "tr") {
+		var row []string
+		for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+				row = append(row, strings.TrimSpace(nodeText(cell)))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	return parseTable(rows, format)
+}
+
+// parseTable maps rows of cells to candidates using the column mapping
+func parseTable(rows [][]string, format config.TableFormat) ([]types.Candidate, error) {
+	if len(rows) == 0 {
+		return []types.Candidate{}, nil
+	}
+
+	var header []string
+	if !format.NoHeader {
+		header, rows = rows[0], rows[1:]
+	}
+
+	columns := format.Columns
+	ipCol, err := columnIndex(header, columns.IP)
+	if err != nil {
+		return nil, err
+	}
+	portCol, err := columnIndex(header, columns.Port)
+	if err != nil {
+		return nil, err
+	}
+	addrCol, err := columnIndex(header, columns.Address)
+	if err != nil {
+		return nil, err
+	}
+	protoCol, err := columnIndex(header, columns.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	countryCol, err := columnIndex(header, columns.Country)
+	if err != nil {
+		return nil, err
+	}
+	userCol, err := columnIndex(header, columns.Username)
+	if err != nil {
+		return nil, err
+	}
+	passCol, err := columnIndex(header, columns.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]types.Candidate, 0, len(rows))
+	for _, row := range rows {
+		cell := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		if candidate, ok := buildCandidate(cell(ipCol), cell(portCol), cell(addrCol),
+			cell(protoCol), cell(countryCol), cell(userCol), cell(passCol)); ok {
+			proxies = append(proxies, candidate)
+		}
+	}
+
+	return proxies, nil
+}
+
+// columnIndex resolves a column reference (header name or numeric index).
+// An empty reference yields -1.
+func columnIndex(header []string, ref string) (int, error) {
+	if ref == "" {
+		return -1, nil
+	}
+	if i, err := strconv.Atoi(ref); err == nil {
+		return i, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), ref) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("column %q not found in header", ref)
+}
+
+// buildCandidate validates and normalizes the extracted fields. Either ip
+// and port or a combined address must be present; a protocol or username
+// given in its own field overrides any scheme or credentials in the address.
+func buildCandidate(ip, port, address, protocol, country, username, password string) (types.Candidate, bool) {
+	if ip != "" && port != "" {
+		if strings.Contains(ip, ":") && !strings.HasPrefix(ip, "[") {
+			ip = "[" + ip + "]"
+		}
+		address = ip + ":" + port
+	}
+
+	candidate, ok := ParseProxyAddress(address)
+	if !ok {
+		return types.Candidate{}, false
+	}
+
+	if p := normalizeProtocol(protocol); p != "" {
+		candidate.Protocol = p
+	}
+	candidate.Country = strings.ToUpper(strings.TrimSpace(country))
+	if username != "" {
+		candidate.Username, candidate.Password = username, password
+	}
+	return candidate, true
+}
+
+func normalizeProtocol(protocol string) string {
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	protocol = strings.TrimSuffix(protocol, "://")
+	switch protocol {
+	case "socks5", "socks5h", "socks":
+		return "socks5"
+	case "socks4", "socks4a":
+		return "socks4"
+	case "https", "http":
+		return protocol
+	default:
+		return ""
+	}
+}
+
+// selectPath evaluates a small JSONPath subset: dot-separated keys with
+// optional [n] or [*] suffixes and an optional leading "$". Wildcards can
+// yield several values.
+func selectPath(value interface{}, path string) []interface{} {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimPrefix(path, ".")
+
+	current := []interface{}{value}
+	if path == "" {
+		return current
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		var indexes []string
+		if i := strings.Index(segment, "["); i >= 0 {
+			key = segment[:i]
+			for _, part := range strings.Split(segment[i:], "[") {
+				if part = strings.TrimSuffix(part, "]"); part != "" {
+					indexes = append(indexes, part)
+				}
+			}
+		}
+
+		next := make([]interface{}, 0, len(current))
+		for _, v := range current {
+			if key != "" {
+				obj, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if v, ok = obj[key]; !ok {
+					continue
+				}
+			}
+			next = append(next, applyIndexes(v, indexes)...)
+		}
+		current = next
+	}
+
+	return current
+}
+
+func applyIndexes(value interface{}, indexes []string) []interface{} {
+	values := []interface{}{value}
+	for _, index := range indexes {
+		next := make([]interface{}, 0)
+		for _, v := range values {
+			arr, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			if index == "*" {
+				next = append(next, arr...)
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err == nil && i >= 0 && i < len(arr) {
+				next = append(next, arr[i])
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+func findElements(n *html.Node, tag string) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == tag {
+			found = append(found, node)
+			// Nested tables are not searched for rows of the outer one
+			if tag == "tr" {
+				return
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if tag == "tr" && child.Type == html.ElementNode && child.Data == "table" {
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(n)
+	return found
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			sb.WriteString(node.Data)
+		}
+		// Skip script/style noise some listing sites inject into cells
+		if node.Type == html.ElementNode && (node.Data == "script" || node.Data == "style") {
+			return
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
@@ -0,0 +1,218 @@
+package aggregator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+const (
+	defaultMaxDecompressedBytes = 100 * 1024 * 1024
+	defaultMaxArchiveEntries    = 1000
+
+	// maxPayloadNesting bounds archives within archives (e.g. .tar.gz is 2)
+	maxPayloadNesting = 3
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip  = []byte("PK\x03\x04")
+	magicTar  = []byte("ustar") // at offset 257
+)
+
+// payloadBudget is what is left of the decompression limits of one payload
+type payloadBudget struct {
+	bytes   int64
+	entries int
+}
+
+func (a *Aggregator) decompressionBudget() *payloadBudget {
+	a.configMu.RLock()
+	cfg := a.config.Decompression
+	a.configMu.RUnlock()
+
+	budget := &payloadBudget{bytes: cfg.MaxBytes, entries: cfg.MaxEntries}
+	if budget.bytes <= 0 {
+		budget.bytes = defaultMaxDecompressedBytes
+	}
+	if budget.entries <= 0 {
+		budget.entries = defaultMaxArchiveEntries
+	}
+	return budget
+}
+
+var errBudgetExceeded = errors.New("decompressed payload exceeds decompression.max_bytes")
+
+// budgetReader fails once the decompressed bytes of a payload exceed the
+// budget. Like http.MaxBytesReader it never returns bytes past the budget,
+// so a caller using io.ReadFull cannot miss the error.
+type budgetReader struct {
+	r      io.Reader
+	budget *payloadBudget
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.budget.bytes < 0 {
+		return 0, errBudgetExceeded
+	}
+	// One byte more than the budget tells a payload that ends exactly at
+	// the budget from one that exceeds it
+	if int64(len(p)) > b.budget.bytes+1 {
+		p = p[:b.budget.bytes+1]
+	}
+	n, err := b.r.Read(p)
+	if int64(n) <= b.budget.bytes {
+		b.budget.bytes -= int64(n)
+		return n, err
+	}
+	n = int(b.budget.bytes)
+	b.budget.bytes = -1
+	return n, errBudgetExceeded
+}
+
+func (b *payloadBudget) reader(r io.Reader) io.Reader {
+	return &budgetReader{r: r, budget: b}
+}
+
+func (b *payloadBudget) takeEntry() error {
+	b.entries--
+	if b.entries < 0 {
+		return errors.New("archive has more entries than decompression.max_entries")
+	}
+	return nil
+}
+
+// parsePayload parses a source body, transparently unpacking gzip, zstd,
+// zip and tar payloads (also nested, like .tar.gz). Candidates read from an
+// archive entry carry the entry name.
+func (a *Aggregator) parsePayload(r io.Reader, source config.Source) ([]types.Candidate, error) {
+	return parseUnpacked(r, source, "", a.decompressionBudget(), 0)
+}
+
+func parseUnpacked(r io.Reader, source config.Source, entry string, budget *payloadBudget, depth int) ([]types.Candidate, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(262)
+
+	if depth >= maxPayloadNesting {
+		return parseEntry(br, source, entry)
+	}
+
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		return parseUnpacked(budget.reader(zr), source, entry, budget, depth+1)
+
+	case bytes.HasPrefix(head, magicZstd):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(budget.bytes)))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		defer zr.Close()
+		return parseUnpacked(budget.reader(zr), source, entry, budget, depth+1)
+
+	case bytes.HasPrefix(head, magicZip):
+		// zip needs random access; the body is already size-limited
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("read zip: %w", err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("zip: %w", err)
+		}
+
+		proxies := make([]types.Candidate, 0)
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || skipArchiveEntry(f.Name) {
+				continue
+			}
+			if err := budget.takeEntry(); err != nil {
+				return nil, err
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("zip entry %s: %w", f.Name, err)
+			}
+			found, err := parseUnpacked(budget.reader(rc), source, joinEntry(entry, f.Name), budget, depth+1)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, found...)
+		}
+		return proxies, nil
+
+	case len(head) >= 262 && bytes.HasPrefix(head[257:], magicTar):
+		tr := tar.NewReader(br)
+		proxies := make([]types.Candidate, 0)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("tar: %w", err)
+			}
+			if hdr.Typeflag != tar.TypeReg || skipArchiveEntry(hdr.Name) {
+				continue
+			}
+			if err := budget.takeEntry(); err != nil {
+				return nil, err
+			}
+			found, err := parseUnpacked(tr, source, joinEntry(entry, hdr.Name), budget, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, found...)
+		}
+		return proxies, nil
+	}
+
+	return parseEntry(br, source, entry)
+}
+
+// parseEntry parses plain content with the source's format
+func parseEntry(r io.Reader, source config.Source, entry string) ([]types.Candidate, error) {
+	proxies, err := parseSource(r, source)
+	if err != nil {
+		if entry != "" {
+			return nil, fmt.Errorf("entry %s: %w", entry, err)
+		}
+		return nil, err
+	}
+	if entry != "" {
+		for i := range proxies {
+			proxies[i].Entry = entry
+		}
+	}
+	return proxies, nil
+}
+
+// skipArchiveEntry ignores hidden files and macOS resource forks
+func skipArchiveEntry(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/")
+}
+
+func joinEntry(outer, name string) string {
+	if outer == "" {
+		return name
+	}
+	return outer + "/" + name
+}
@@ -0,0 +1,202 @@
+package aggregator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+type archiveFile struct {
+	name string
+	body string
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarBytes(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// proxyList returns n distinct proxy lines
+func proxyList(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "8.8.%d.%d:80\n", i/250, i%250+1)
+	}
+	return b.String()
+}
+
+func TestParsePayload(t *testing.T) {
+	list := []byte("1.2.3.4:80\n5.6.7.8:80\n")
+	want := []types.Candidate{{Address: "1.2.3.4:80"}, {Address: "5.6.7.8:80"}}
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []types.Candidate
+	}{
+		{"plain", list, want},
+		{"gzip", gzipBytes(t, list), want},
+		{"zstd", zstdBytes(t, list), want},
+		{"zip", zipBytes(t, archiveFile{"a.txt", "1.2.3.4:80\n"}, archiveFile{"dir/b.txt", "5.6.7.8:80\n"}),
+			[]types.Candidate{{Address: "1.2.3.4:80", Entry: "a.txt"}, {Address: "5.6.7.8:80", Entry: "dir/b.txt"}}},
+		{"tar.gz", gzipBytes(t, tarBytes(t, archiveFile{"a.txt", "1.2.3.4:80\n"})),
+			[]types.Candidate{{Address: "1.2.3.4:80", Entry: "a.txt"}}},
+		{"hidden entries skipped", zipBytes(t, archiveFile{".hidden", "1.2.3.4:80\n"},
+			archiveFile{"__MACOSX/a.txt", "1.2.3.4:80\n"}, archiveFile{"b.txt", "5.6.7.8:80\n"}),
+			[]types.Candidate{{Address: "5.6.7.8:80", Entry: "b.txt"}}},
+		{"archive in archive", zipBytes(t, archiveFile{"inner.tar", string(tarBytes(t, archiveFile{"a.txt", "1.2.3.4:80\n"}))}),
+			[]types.Candidate{{Address: "1.2.3.4:80", Entry: "inner.tar/a.txt"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregator(config.AggregatorConfig{}, testMetrics)
+			got, err := a.parsePayload(bytes.NewReader(tt.payload), config.Source{Type: "txt"})
+			if err != nil {
+				t.Fatalf("parsePayload: %v", err)
+			}
+			assertCandidates(t, got, tt.want)
+		})
+	}
+}
+
+func TestParsePayloadBudget(t *testing.T) {
+	// 100 lines of 12-13 bytes: about 1.3KB decompressed
+	list := []byte(proxyList(100))
+	entries := func(n int) []archiveFile {
+		files := make([]archiveFile, n)
+		for i := range files {
+			files[i] = archiveFile{fmt.Sprintf("list%d.txt", i), proxyList(10)}
+		}
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		limits  config.DecompressionConfig
+		payload []byte
+		wantErr string
+	}{
+		{"gzip within budget", config.DecompressionConfig{MaxBytes: 4096}, gzipBytes(t, list), ""},
+		{"gzip exactly the budget", config.DecompressionConfig{MaxBytes: int64(len(list))}, gzipBytes(t, list), ""},
+		{"gzip one byte over", config.DecompressionConfig{MaxBytes: int64(len(list)) - 1}, gzipBytes(t, list), "exceeds"},
+		{"gzip over budget", config.DecompressionConfig{MaxBytes: 512}, gzipBytes(t, list), "exceeds"},
+		// zstd enforces the budget as its window limit, too
+		{"zstd over budget", config.DecompressionConfig{MaxBytes: 512}, zstdBytes(t, list), "exceeds"},
+		// Every entry is under the limit, but they share one budget
+		{"zip entries share the budget", config.DecompressionConfig{MaxBytes: 512}, zipBytes(t, entries(5)...), "exceeds"},
+		{"nested layers share the budget", config.DecompressionConfig{MaxBytes: 2048},
+			gzipBytes(t, tarBytes(t, archiveFile{"list.txt", string(list)})), "exceeds"},
+		{"entries within limit", config.DecompressionConfig{MaxEntries: 5}, zipBytes(t, entries(5)...), ""},
+		{"too many zip entries", config.DecompressionConfig{MaxEntries: 4}, zipBytes(t, entries(5)...), "max_entries"},
+		{"too many tar entries", config.DecompressionConfig{MaxEntries: 4}, tarBytes(t, entries(5)...), "max_entries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregator(config.AggregatorConfig{Decompression: tt.limits}, testMetrics)
+			_, err := a.parsePayload(bytes.NewReader(tt.payload), config.Source{Type: "txt"})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("parsePayload: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("parsePayload error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParsePayloadNestingLimit(t *testing.T) {
+	// Large enough to be compressed, so no line shows up verbatim in the
+	// outer layers
+	list := proxyList(200)
+	payload := []byte(list)
+	for i := 0; i < maxPayloadNesting; i++ {
+		payload = gzipBytes(t, payload)
+	}
+
+	a := NewAggregator(config.AggregatorConfig{}, testMetrics)
+	got, err := a.parsePayload(bytes.NewReader(payload), config.Source{Type: "txt"})
+	if err != nil {
+		t.Fatalf("parsePayload at the nesting limit: %v", err)
+	}
+	if len(got) != 200 {
+		t.Fatalf("parsePayload at the nesting limit = %d proxies, want 200", len(got))
+	}
+
+	// One layer more is parsed as it is, without unpacking
+	got, err = a.parsePayload(bytes.NewReader(gzipBytes(t, payload)), config.Source{Type: "txt"})
+	if err == nil && len(got) == 200 {
+		t.Error("payload nested beyond the limit was unpacked")
+	}
+}
@@ -0,0 +1,81 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+// SourceProvider fetches the candidates of one source. Metadata a source
+// publishes about a proxy (protocol, country, credentials) travels on the
+// candidates themselves.
+type SourceProvider interface {
+	Fetch(ctx context.Context) ([]types.Candidate, error)
+}
+
+// ProviderFactory returns the provider for a source, or an error if the
+// source is invalid for it. It runs on every fetch and whenever a source is
+// validated, so it should not do I/O.
+type ProviderFactory func(source config.Source) (SourceProvider, error)
+
+// revalidator is implemented by providers that can confirm a cached result
+// is still current instead of fetching it again
+type revalidator interface {
+	fetchIfModified(ctx context.Context, cached *cacheEntry) (httpResult, error)
+}
+
+// RegisterProvider makes sources of sourceType, their URL scheme, fetchable
+// through factory. The built-in types are http, https, file, stdin and
+// ingest.
+func (a *Aggregator) RegisterProvider(sourceType string, factory ProviderFactory) error {
+	a.providersMu.Lock()
+	defer a.providersMu.Unlock()
+
+	if _, exists := a.providers[sourceType]; exists {
+		return fmt.Errorf("provider for source type %q already registered", sourceType)
+	}
+	a.providers[sourceType] = factory
+	return nil
+}
+
+// TransientError marks err as temporary, so a provider's cached result
+// within cache_max_staleness_seconds stands in for the failed fetch
+func TransientError(err error) error {
+	return &fetchError{err: err, transient: true}
+}
+
+func (a *Aggregator) registerBuiltinProviders() {
+	a.providers["http"] = a.newHTTPProvider
+	a.providers["https"] = a.newHTTPProvider
+	a.providers["file"] = a.newFileProvider
+	a.providers["stdin"] = a.newStdinProvider
+	a.providers["ingest"] = a.newIngestProvider
+}
+
+// providerFor returns the provider registered for the source's type
+func (a *Aggregator) providerFor(source config.Source) (SourceProvider, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL %q", source.URL)
+	}
+
+	a.providersMu.RLock()
+	factory, ok := a.providers[u.Scheme]
+	a.providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported source URL scheme %q", u.Scheme)
+	}
+
+	return factory(source)
+}
+
+func (a *Aggregator) fetchSource(ctx context.Context, source config.Source) ([]types.Candidate, error) {
+	provider, err := a.providerFor(source)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Fetch(ctx)
+}
@@ -0,0 +1,260 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+const (
+	defaultFetchTimeout = 30 * time.Second
+	defaultMaxBodyBytes = 10 * 1024 * 1024
+)
+
+// httpResult is the outcome of one HTTP fetch
+type httpResult struct {
+	proxies      []types.Candidate
+	notModified  bool
+	etag         string
+	lastModified string
+	pages        int // pages crawled, for paginated sources
+
+	next string // next page of a paginated source, if any
+}
+
+// fetchError marks failures where a cached result may stand in: network
+// errors, timeouts, 5xx and 429 responses
+type fetchError struct {
+	err       error
+	transient bool
+}
+
+func (e *fetchError) Error() string { return e.err.Error() }
+func (e *fetchError) Unwrap() error { return e.err }
+
+func isTransient(err error) bool {
+	var fe *fetchError
+	return errors.As(err, &fe) && fe.transient
+}
+
+// httpProvider fetches http(s) sources, conditionally when a cached result
+// exists
+type httpProvider struct {
+	a      *Aggregator
+	source config.Source
+}
+
+func (a *Aggregator) newHTTPProvider(source config.Source) (SourceProvider, error) {
+	if u, err := url.Parse(source.URL); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid source URL %q", source.URL)
+	}
+	return httpProvider{a: a, source: source}, nil
+}
+
+func (p httpProvider) Fetch(ctx context.Context) ([]types.Candidate, error) {
+	result, err := p.a.fetchHTTP(ctx, p.source, nil)
+	return result.proxies, err
+}
+
+func (p httpProvider) fetchIfModified(ctx context.Context, cached *cacheEntry) (httpResult, error) {
+	return p.a.fetchHTTP(ctx, p.source, cached)
+}
+
+// fetchHTTP fetches an http(s) source using its request settings. With
+// cached validators the request is conditional and a 304 is reported as
+// notModified. Paginated sources are crawled unconditionally.
+func (a *Aggregator) fetchHTTP(ctx context.Context, source config.Source, cached *cacheEntry) (httpResult, error) {
+	if source.Pagination != nil {
+		return a.fetchPages(ctx, source)
+	}
+	return a.fetchPage(ctx, source, source.URL, cached)
+}
+
+// fetchPage fetches and parses one response. For paginated sources it also
+// works out the next page from the Link header or the cursor field.
+func (a *Aggregator) fetchPage(ctx context.Context, source config.Source, rawURL string, cached *cacheEntry) (httpResult, error) {
+	var opts config.RequestOptions
+	if source.Request != nil {
+		opts = *source.Request
+	}
+
+	timeout := defaultFetchTimeout
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := newSourceRequest(ctx, rawURL, opts)
+	if err != nil {
+		return httpResult{}, err
+	}
+	if userAgent := a.userAgent(); userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	client, err := a.clientFor(opts.Proxy)
+	if err != nil {
+		return httpResult{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return httpResult{}, &fetchError{err: fmt.Errorf("fetch: %w", err), transient: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return httpResult{notModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return httpResult{}, &fetchError{
+			err:       fmt.Errorf("HTTP %d", resp.StatusCode),
+			transient: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
+	}
+
+	result := httpResult{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	body := io.LimitReader(resp.Body, bodyLimit(source))
+
+	pagination := source.Pagination
+	switch {
+	case pagination != nil && pagination.Type == "link":
+		result.next = nextLink(resp.Request.URL, resp.Header.Values("Link"))
+	case pagination != nil && pagination.Type == "cursor":
+		// The body is parsed twice: for proxies and for the cursor
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return httpResult{}, &fetchError{err: fmt.Errorf("read body: %w", err), transient: true}
+		}
+		body = bytes.NewReader(data)
+		if result.next, err = nextCursorPage(resp.Request.URL, data, *pagination); err != nil {
+			return httpResult{}, err
+		}
+	}
+
+	if result.proxies, err = a.parsePayload(body, source); err != nil {
+		return httpResult{}, err
+	}
+	return result, nil
+}
+
+// newSourceRequest builds the request, resolving env-referenced secrets
+func newSourceRequest(ctx context.Context, rawURL string, opts config.RequestOptions) (*http.Request, error) {
+	method := strings.ToUpper(opts.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, env := range opts.HeadersEnv {
+		value, err := lookupEnv(env)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+
+	if opts.Auth != nil {
+		switch opts.Auth.Type {
+		case "basic":
+			password := ""
+			if opts.Auth.PasswordEnv != "" {
+				if password, err = lookupEnv(opts.Auth.PasswordEnv); err != nil {
+					return nil, fmt.Errorf("basic auth: %w", err)
+				}
+			}
+			req.SetBasicAuth(opts.Auth.Username, password)
+		case "bearer":
+			token, err := lookupEnv(opts.Auth.TokenEnv)
+			if err != nil {
+				return nil, fmt.Errorf("bearer auth: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	return req, nil
+}
+
+func lookupEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// clientFor returns the shared client, or one routed through proxyURL.
+// Proxied clients are created once per upstream proxy and reused.
+func (a *Aggregator) clientFor(proxyURL string) (*http.Client, error) {
+	if proxyURL == "" {
+		return a.client, nil
+	}
+
+	a.clientsMu.Lock()
+	defer a.clientsMu.Unlock()
+
+	if client, ok := a.clients[proxyURL]; ok {
+		return client, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse request proxy: %w", err)
+	}
+
+	client := &http.Client{Transport: newTransport(http.ProxyURL(u))}
+	a.clients[proxyURL] = client
+	return client, nil
+}
+
+func newTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	return &http.Transport{
+		Proxy:               proxy,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// bodyLimit returns how many bytes of a source are read
+func bodyLimit(source config.Source) int64 {
+	if source.Request != nil && source.Request.MaxBodyBytes > 0 {
+		return source.Request.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
@@ -0,0 +1,248 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/cron"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// sourceResult is the latest fetch outcome of a source. Together they form
+// the merged candidate set that every check cycle consumes.
+type sourceResult struct {
+	fingerprint string
+	proxies     []types.Candidate
+	stat        SourceStats
+	nextFetch   time.Time // zero for sources fetched with every cycle
+}
+
+// hasOwnSchedule reports whether a source is fetched on its own cadence
+// rather than with every check cycle
+func hasOwnSchedule(source config.Source) bool {
+	return source.IntervalSeconds > 0 || source.Schedule != ""
+}
+
+// nextFetchTime returns when a source fetched at now is due again
+func nextFetchTime(source config.Source, now time.Time) time.Time {
+	switch {
+	case source.IntervalSeconds > 0:
+		return now.Add(time.Duration(source.IntervalSeconds) * time.Second)
+	case source.Schedule != "":
+		schedule, err := cron.Parse(source.Schedule)
+		if err != nil {
+			return time.Time{}
+		}
+		return schedule.Next(now)
+	default:
+		return time.Time{}
+	}
+}
+
+// RunScheduler fetches sources that have their own interval or schedule
+// when they are due, independently of check cycles, until ctx is done
+func (a *Aggregator) RunScheduler(ctx context.Context) {
+	for {
+		wait := a.untilNextScheduledFetch(time.Now())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-a.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		a.fetchMu.Lock()
+		var scheduled []config.Source
+		for _, source := range a.activeSources() {
+			if hasOwnSchedule(source) {
+				scheduled = append(scheduled, source)
+			}
+		}
+		if due := a.dueSources(scheduled, time.Now(), true); len(due) > 0 {
+			log.Infof("Fetching %d scheduled sources", len(due))
+			a.fetchSources(ctx, due)
+		}
+		a.fetchMu.Unlock()
+	}
+}
+
+// untilNextScheduledFetch returns how long the scheduler may sleep. It
+// wakes at least every minute to pick up clock changes.
+func (a *Aggregator) untilNextScheduledFetch(now time.Time) time.Duration {
+	wait := time.Minute
+	sources := a.activeSources()
+
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+
+	for _, source := range sources {
+		if !hasOwnSchedule(source) {
+			continue
+		}
+		result, ok := a.results[source.Name]
+		if !ok || result.fingerprint != sourceFingerprint(source) {
+			return 0
+		}
+		if result.nextFetch.IsZero() {
+			continue // no further match, e.g. "0 0 30 2 *"
+		}
+		if d := result.nextFetch.Sub(now); d < wait {
+			wait = d
+		}
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// wakeScheduler makes the scheduler re-evaluate due sources now
+func (a *Aggregator) wakeScheduler() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// markDue makes a source due at the next fetch pass
+func (a *Aggregator) markDue(name string) {
+	a.resultsMu.Lock()
+	if result, ok := a.results[name]; ok {
+		result.fingerprint = ""
+	}
+	a.resultsMu.Unlock()
+	a.wakeScheduler()
+}
+
+// dueSources returns the sources that need fetching: those never fetched
+// or changed since, scheduled sources past their next fetch time and,
+// unless scheduledOnly, every source without its own schedule
+func (a *Aggregator) dueSources(sources []config.Source, now time.Time, scheduledOnly bool) []config.Source {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+
+	due := make([]config.Source, 0, len(sources))
+	for _, source := range sources {
+		result, ok := a.results[source.Name]
+		switch {
+		case !ok || result.fingerprint != sourceFingerprint(source):
+			due = append(due, source)
+		case !hasOwnSchedule(source):
+			if !scheduledOnly {
+				due = append(due, source)
+			}
+		case !result.nextFetch.IsZero() && !now.Before(result.nextFetch):
+			due = append(due, source)
+		}
+	}
+	return due
+}
+
+// fetchSources fetches sources concurrently and stores their results.
+// Sources in failure backoff are skipped; sources crossing
+// disable_after_failures are disabled.
+func (a *Aggregator) fetchSources(ctx context.Context, sources []config.Source) {
+	now := time.Now()
+	var wg sync.WaitGroup
+
+	for _, source := range sources {
+		if until, ok := a.backingOff(source.Name, now); ok {
+			a.skipForBackoff(source, until)
+			continue
+		}
+
+		wg.Add(1)
+		go func(src config.Source) {
+			defer wg.Done()
+
+			stat := SourceStats{URL: src.URL}
+
+			startTime := time.Now()
+			proxies, err := a.fetchCached(ctx, src, &stat)
+			duration := time.Since(startTime)
+
+			// A cancelled cycle says nothing about the source
+			if ctx.Err() != nil {
+				return
+			}
+
+			stat.ProxiesFound = len(proxies)
+
+			switch {
+			case err != nil && stat.Stale:
+				stat.Error = err.Error()
+			case err != nil:
+				stat.Error = err.Error()
+				log.Warnf("Source %s failed: %v (took %v)", src.URL, err, duration)
+			case stat.CacheHit:
+				log.Infof("Source %s not modified, reusing %d proxies (took %v)", src.URL, len(proxies), duration)
+			default:
+				log.Infof("Source %s returned %d proxies (took %v)", src.URL, len(proxies), duration)
+			}
+
+			a.metrics.RecordProxiesScraped(src.URL, len(proxies))
+
+			result := &sourceResult{
+				fingerprint: sourceFingerprint(src),
+				proxies:     proxies,
+				stat:        stat,
+				nextFetch:   nextFetchTime(src, time.Now()),
+			}
+			a.resultsMu.Lock()
+			a.results[src.Name] = result
+			a.resultsMu.Unlock()
+
+			a.recordFetch(src, err)
+		}(source)
+	}
+
+	wg.Wait()
+
+	a.persistHealth()
+}
+
+// skipForBackoff records that a source was not fetched. Its previous
+// result is kept; a scheduled source is not due again before the backoff
+// ends.
+func (a *Aggregator) skipForBackoff(source config.Source, until time.Time) {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+
+	result, ok := a.results[source.Name]
+	if !ok || result.fingerprint != sourceFingerprint(source) {
+		result = &sourceResult{
+			fingerprint: sourceFingerprint(source),
+			stat:        SourceStats{URL: source.URL},
+		}
+		a.results[source.Name] = result
+	}
+	result.stat.Error = fmt.Sprintf("backing off until %s", until.Format(time.RFC3339))
+	if hasOwnSchedule(source) && result.nextFetch.Before(until) {
+		result.nextFetch = until
+	}
+}
+
+// pruneResults drops the results of sources that were removed or disabled
+func (a *Aggregator) pruneResults(enabled []config.Source) {
+	names := make(map[string]bool, len(enabled))
+	for _, source := range enabled {
+		names[source.Name] = true
+	}
+
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	for name := range a.results {
+		if !names[name] {
+			delete(a.results, name)
+		}
+	}
+}
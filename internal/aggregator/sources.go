@@ -0,0 +1,244 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const sourcesBlobName = "sources"
+
+var (
+	ErrSourceNotFound = errors.New("source not found")
+	ErrSourceExists   = errors.New("source already exists")
+)
+
+// EnablePersistence stores runtime source edits in store. A previously
+// persisted source list takes precedence over the one from config.json.
+func (a *Aggregator) EnablePersistence(store storage.Storage) error {
+	data, err := store.LoadBlob(sourcesBlobName)
+	if err != nil {
+		return fmt.Errorf("load sources: %w", err)
+	}
+
+	a.sourcesMu.Lock()
+	defer a.sourcesMu.Unlock()
+
+	a.store = store
+
+	if err := a.loadHealth(); err != nil {
+		log.Warnf("Failed to load source health: %v", err)
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	var sources []config.Source
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return fmt.Errorf("parse stored sources: %w", err)
+	}
+
+	a.sources = sources
+	log.Infof("Loaded %d sources from storage (overriding config)", len(sources))
+	return nil
+}
+
+// Sources returns a copy of the current source list
+func (a *Aggregator) Sources() []config.Source {
+	a.sourcesMu.RLock()
+	defer a.sourcesMu.RUnlock()
+
+	sources := make([]config.Source, len(a.sources))
+	copy(sources, a.sources)
+	return sources
+}
+
+// activeSources returns the enabled sources that were not disabled after
+// repeated failures
+func (a *Aggregator) activeSources() []config.Source {
+	sources := a.Sources()
+
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	active := make([]config.Source, 0, len(sources))
+	for _, source := range sources {
+		if source.Enabled && !a.autoDisabledLocked(source.Name) {
+			active = append(active, source)
+		}
+	}
+	return active
+}
+
+// Source returns the source with the given name
+func (a *Aggregator) Source(name string) (config.Source, error) {
+	a.sourcesMu.RLock()
+	defer a.sourcesMu.RUnlock()
+
+	if i := a.indexOf(name); i >= 0 {
+		return a.sources[i], nil
+	}
+	return config.Source{}, ErrSourceNotFound
+}
+
+// AddSource appends a source to the running aggregator
+func (a *Aggregator) AddSource(source config.Source) (config.Source, error) {
+	if source.Name == "" {
+		source.Name = config.DefaultSourceName(source.URL)
+	}
+	if err := a.validateSource(source); err != nil {
+		return config.Source{}, err
+	}
+
+	a.sourcesMu.Lock()
+	defer a.sourcesMu.Unlock()
+
+	if a.indexOf(source.Name) >= 0 {
+		return config.Source{}, ErrSourceExists
+	}
+
+	previous := a.sources
+	a.sources = append(append([]config.Source(nil), a.sources...), source)
+
+	if err := a.persistLocked(); err != nil {
+		a.sources = previous
+		return config.Source{}, err
+	}
+
+	log.Infof("Source %s added (%s)", source.Name, source.URL)
+	go a.refreshWatches()
+	a.wakeScheduler()
+	return source, nil
+}
+
+// UpdateSource applies update to the named source
+func (a *Aggregator) UpdateSource(name string, update func(*config.Source)) (config.Source, error) {
+	a.sourcesMu.Lock()
+	defer a.sourcesMu.Unlock()
+
+	i := a.indexOf(name)
+	if i < 0 {
+		return config.Source{}, ErrSourceNotFound
+	}
+
+	current := a.sources[i]
+	updated := current
+	update(&updated)
+	updated.Name = name
+	if err := a.validateSource(updated); err != nil {
+		return config.Source{}, err
+	}
+
+	a.healthMu.Lock()
+	wasActive := current.Enabled && !a.autoDisabledLocked(name)
+	a.healthMu.Unlock()
+
+	previous := a.sources
+	a.sources = append([]config.Source(nil), a.sources...)
+	a.sources[i] = updated
+
+	if err := a.persistLocked(); err != nil {
+		a.sources = previous
+		return config.Source{}, err
+	}
+
+	// Re-enabling (also after an automatic disable) or repointing a source
+	// gives it a clean slate
+	if (!wasActive && updated.Enabled) || current.URL != updated.URL {
+		a.resetHealth(name)
+	}
+
+	log.Infof("Source %s updated", name)
+	go a.refreshWatches()
+	a.wakeScheduler()
+	return updated, nil
+}
+
+// RemoveSource deletes the named source
+func (a *Aggregator) RemoveSource(name string) error {
+	a.sourcesMu.Lock()
+	defer a.sourcesMu.Unlock()
+
+	i := a.indexOf(name)
+	if i < 0 {
+		return ErrSourceNotFound
+	}
+
+	previous := a.sources
+	a.sources = append(append([]config.Source(nil), a.sources[:i]...), a.sources[i+1:]...)
+
+	if err := a.persistLocked(); err != nil {
+		a.sources = previous
+		return err
+	}
+
+	log.Infof("Source %s removed", name)
+	go a.refreshWatches()
+	a.wakeScheduler()
+	return nil
+}
+
+// TrialFetch fetches and parses a source once without registering it and
+// returns the number of proxies found
+func (a *Aggregator) TrialFetch(ctx context.Context, source config.Source) (int, error) {
+	if err := a.validateSource(source); err != nil {
+		return 0, err
+	}
+	proxies, err := a.fetchSource(ctx, source)
+	if err != nil {
+		return 0, err
+	}
+	return len(proxies), nil
+}
+
+func (a *Aggregator) indexOf(name string) int {
+	for i, source := range a.sources {
+		if source.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a *Aggregator) persistLocked() error {
+	if a.store == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(a.sources)
+	if err != nil {
+		return fmt.Errorf("marshal sources: %w", err)
+	}
+	if err := a.store.SaveBlob(sourcesBlobName, data); err != nil {
+		return fmt.Errorf("persist sources: %w", err)
+	}
+	return nil
+}
+
+// validateSource checks that a registered provider accepts the source
+func (a *Aggregator) validateSource(source config.Source) error {
+	if strings.HasPrefix(source.URL, ingestURLPrefix) {
+		return fmt.Errorf("ingest:// sources are created by POST /ingest")
+	}
+	if strings.Contains(source.Name, "#") {
+		return fmt.Errorf("source name must not contain '#'")
+	}
+	if _, err := a.providerFor(source); err != nil {
+		return err
+	}
+
+	if source.Pagination != nil && !strings.HasPrefix(source.URL, "http") {
+		return fmt.Errorf("pagination is only supported for http(s) sources")
+	}
+	if source.Watch && !strings.HasPrefix(source.URL, "file:") {
+		return fmt.Errorf("watch is only supported for file:// sources")
+	}
+	return source.Validate()
+}
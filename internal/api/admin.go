@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/proxy-checker-api/internal/aggregator"
+	"github.com/proxy-checker-api/internal/auth"
+	"github.com/proxy-checker-api/internal/config"
+)
+
+// keyView is the API representation of a key; the hash is never exposed
+type keyView struct {
+	Name               string     `json:"name"`
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute,omitempty"`
+	DailyProxyQuota    int        `json:"daily_proxy_quota,omitempty"`
+	DailyIngestQuota   int        `json:"daily_ingest_quota,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	Revoked            bool       `json:"revoked"`
+	Disabled           bool       `json:"disabled,omitempty"` // no usable secret, e.g. secret_env is empty
+	CreatedAt          time.Time  `json:"created_at"`
+	RotatedAt          *time.Time `json:"rotated_at,omitempty"`
+}
+
+func newKeyView(key auth.Key) keyView {
+	return keyView{
+		Name:               key.Name,
+		Scopes:             key.Scopes,
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		DailyProxyQuota:    key.DailyProxyQuota,
+		DailyIngestQuota:   key.DailyIngestQuota,
+		ExpiresAt:          key.ExpiresAt,
+		Revoked:            key.Revoked,
+		Disabled:           key.Disabled(),
+		CreatedAt:          key.CreatedAt,
+		RotatedAt:          key.RotatedAt,
+	}
+}
+
+type createKeyRequest struct {
+	Name               string     `json:"name" binding:"required"`
+	Scopes             []string   `json:"scopes" binding:"required"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	DailyProxyQuota    int        `json:"daily_proxy_quota"`
+	DailyIngestQuota   int        `json:"daily_ingest_quota"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+}
+
+func (s *Server) handleListKeys(c *gin.Context) {
+	keys := s.keys.List()
+	views := make([]keyView, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, newKeyView(key))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys": views,
+	})
+}
+
+func (s *Server) handleCreateKey(c *gin.Context) {
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	key, secret, err := s.keys.Create(auth.Key{
+		Name:               req.Name,
+		Scopes:             req.Scopes,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		DailyProxyQuota:    req.DailyProxyQuota,
+		DailyIngestQuota:   req.DailyIngestQuota,
+		ExpiresAt:          req.ExpiresAt,
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, auth.ErrKeyExists) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    newKeyView(key),
+		"secret": secret,
+	})
+}
+
+func (s *Server) handleRotateKey(c *gin.Context) {
+	key, secret, err := s.keys.Rotate(c.Param("name"))
+	if err != nil {
+		s.keyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":    newKeyView(key),
+		"secret": secret,
+	})
+}
+
+func (s *Server) handleRevokeKey(c *gin.Context) {
+	if err := s.keys.Revoke(c.Param("name")); err != nil {
+		s.keyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Key revoked",
+	})
+}
+
+func (s *Server) keyError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+type sourceRequest struct {
+	Name            string                 `json:"name"`
+	URL             string                 `json:"url"`
+	Type            string                 `json:"type"`
+	Enabled         *bool                  `json:"enabled"`
+	Watch           bool                   `json:"watch"`
+	IntervalSeconds int                    `json:"interval_seconds"`
+	Schedule        string                 `json:"schedule"`
+	JSON            *config.JSONFormat     `json:"json"`
+	CSV             *config.TableFormat    `json:"csv"`
+	HTML            *config.TableFormat    `json:"html"`
+	Request         *config.RequestOptions `json:"request"`
+	Pagination      *config.Pagination     `json:"pagination"`
+}
+
+type sourcePatchRequest struct {
+	URL             *string                `json:"url"`
+	Type            *string                `json:"type"`
+	Enabled         *bool                  `json:"enabled"`
+	Watch           *bool                  `json:"watch"`
+	IntervalSeconds *int                   `json:"interval_seconds"`
+	Schedule        *string                `json:"schedule"`
+	JSON            *config.JSONFormat     `json:"json"`
+	CSV             *config.TableFormat    `json:"csv"`
+	HTML            *config.TableFormat    `json:"html"`
+	Request         *config.RequestOptions `json:"request"`
+	Pagination      *config.Pagination     `json:"pagination"`
+}
+
+func (s *Server) handleListSources(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"sources": s.aggregator.Sources(),
+	})
+}
+
+func (s *Server) handleCreateSource(c *gin.Context) {
+	var req sourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	source := config.Source{
+		Name:            req.Name,
+		URL:             req.URL,
+		Type:            req.Type,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+		Watch:           req.Watch,
+		IntervalSeconds: req.IntervalSeconds,
+		Schedule:        req.Schedule,
+		JSON:            req.JSON,
+		CSV:             req.CSV,
+		HTML:            req.HTML,
+		Request:         req.Request,
+		Pagination:      req.Pagination,
+	}
+	if source.Type == "" {
+		source.Type = "txt"
+	}
+
+	found, ok := s.trialFetch(c, source)
+	if !ok {
+		return
+	}
+
+	source, err := s.aggregator.AddSource(source)
+	if err != nil {
+		s.sourceError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"source": source,
+	}
+	if found >= 0 {
+		response["proxies_found"] = found
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+func (s *Server) handleUpdateSource(c *gin.Context) {
+	var req sourcePatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	name := c.Param("name")
+	current, err := s.aggregator.Source(name)
+	if err != nil {
+		s.sourceError(c, err)
+		return
+	}
+
+	apply := func(src *config.Source) {
+		if req.URL != nil {
+			src.URL = *req.URL
+		}
+		if req.Type != nil {
+			src.Type = *req.Type
+		}
+		if req.Enabled != nil {
+			src.Enabled = *req.Enabled
+		}
+		if req.Watch != nil {
+			src.Watch = *req.Watch
+		}
+		if req.IntervalSeconds != nil {
+			src.IntervalSeconds = *req.IntervalSeconds
+		}
+		if req.Schedule != nil {
+			src.Schedule = *req.Schedule
+		}
+		if req.JSON != nil {
+			src.JSON = req.JSON
+		}
+		if req.CSV != nil {
+			src.CSV = req.CSV
+		}
+		if req.HTML != nil {
+			src.HTML = req.HTML
+		}
+		if req.Request != nil {
+			src.Request = req.Request
+		}
+		if req.Pagination != nil {
+			src.Pagination = req.Pagination
+		}
+	}
+
+	// Only re-validate when what is fetched or how it is parsed changed
+	found := -1
+	if req.URL != nil || req.Type != nil || req.JSON != nil || req.CSV != nil || req.HTML != nil ||
+		req.Request != nil || req.Pagination != nil {
+		candidate := current
+		apply(&candidate)
+		var ok bool
+		if found, ok = s.trialFetch(c, candidate); !ok {
+			return
+		}
+	}
+
+	source, err := s.aggregator.UpdateSource(name, apply)
+	if err != nil {
+		s.sourceError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"source": source,
+	}
+	if found >= 0 {
+		response["proxies_found"] = found
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) handleDeleteSource(c *gin.Context) {
+	if err := s.aggregator.RemoveSource(c.Param("name")); err != nil {
+		s.sourceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Source removed",
+	})
+}
+
+// trialFetch validates a source by fetching it once. Validation can be
+// skipped with ?validate=0 (e.g. for sources that are temporarily down).
+func (s *Server) trialFetch(c *gin.Context, source config.Source) (int, bool) {
+	if c.Query("validate") == "0" {
+		return -1, true
+	}
+
+	// Stay well inside the server's write timeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	found, err := s.aggregator.TrialFetch(ctx, source)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": fmt.Sprintf("trial fetch failed: %v", err),
+		})
+		return 0, false
+	}
+
+	return found, true
+}
+
+func (s *Server) sourceError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, aggregator.ErrSourceNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, aggregator.ErrSourceExists):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/proxy-checker-api/internal/aggregator"
+	"github.com/proxy-checker-api/internal/auth"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+// defaultIngestSource names the virtual source of requests without an
+// authenticated key
+const defaultIngestSource = "ingest"
+
+func (s *Server) handleIngest(c *gin.Context) {
+	limits := s.aggregator.IngestConfig()
+	key := requestKey(c)
+
+	// Each key pushes into its own virtual source; only admin keys may name
+	// another one, so keys cannot replace each other's candidates
+	source := defaultIngestSource
+	if key != nil {
+		source = key.Name
+	}
+	if requested := c.Query("source"); requested != "" && requested != source {
+		if key == nil || !key.HasScope(auth.ScopeAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Only admin keys can push into another source",
+			})
+			return
+		}
+		source = requested
+	}
+	if !aggregator.ValidIngestSource(source) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid source name",
+		})
+		return
+	}
+
+	format := ingestFormat(c)
+	if format == "" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Unsupported format; use text, json or ndjson",
+		})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid gzip body",
+			})
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// The limit applies after decompression, so small gzip bombs are cut off
+	data, err := io.ReadAll(io.LimitReader(body, limits.MaxBodyBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read body: " + err.Error(),
+		})
+		return
+	}
+	if int64(len(data)) > limits.MaxBodyBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": "Body exceeds max_body_bytes",
+		})
+		return
+	}
+
+	candidates, err := aggregator.ParseIngest(bytes.NewReader(data), format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	received := len(candidates)
+	truncated := 0
+	if len(candidates) > limits.MaxCandidates {
+		truncated = len(candidates) - limits.MaxCandidates
+		candidates = candidates[:limits.MaxCandidates]
+	}
+
+	// Quota is taken up front so concurrent pushes cannot overrun it, and
+	// given back if the push is refused
+	charged := 0
+	if key != nil && key.DailyIngestQuota > 0 {
+		granted := s.keys.ConsumeIngestQuota(key, len(candidates))
+		if granted == 0 && len(candidates) > 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Daily ingest quota exceeded",
+			})
+			return
+		}
+		truncated += len(candidates) - granted
+		candidates = candidates[:granted]
+		charged = granted
+	}
+
+	result, err := s.aggregator.Ingest(source, candidates, s.poolContains())
+	if err != nil {
+		if charged > 0 {
+			s.keys.RefundIngestQuota(key, charged)
+		}
+		if errors.Is(err, aggregator.ErrTooManyIngestSources) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many ingest sources; max_sources reached",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"source":    source,
+		"received":  received,
+		"truncated": truncated,
+		"accepted":  result.Accepted,
+		"refreshed": result.Refreshed,
+		"in_pool":   result.InPool,
+		"dropped":   result.Dropped,
+		"retained":  result.Retained,
+	})
+}
+
+// ingestFormat picks the body format from ?format= or the Content-Type
+// header, defaulting to plain text. An unknown format yields "".
+func ingestFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		switch format {
+		case aggregator.IngestText, aggregator.IngestJSON, aggregator.IngestNDJSON:
+			return format
+		}
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return aggregator.IngestJSON
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return aggregator.IngestNDJSON
+	default:
+		return aggregator.IngestText
+	}
+}
+
+// poolContains returns a lookup of the proxies currently served
+func (s *Server) poolContains() func(types.Candidate) bool {
+	proxies := s.snapshot.GetAll()
+	pool := make(map[string]bool, len(proxies))
+	for _, p := range proxies {
+		pool[p.Candidate().Key()] = true
+	}
+
+	return func(candidate types.Candidate) bool {
+		return pool[candidate.Key()]
+	}
+}
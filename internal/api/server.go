@@ -2,23 +2,28 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
-	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/proxy-checker-api/internal/aggregator"
+	"github.com/proxy-checker-api/internal/auth"
 	"github.com/proxy-checker-api/internal/checker"
 	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/cycle"
 	"github.com/proxy-checker-api/internal/metrics"
+	"github.com/proxy-checker-api/internal/ratelimit"
 	"github.com/proxy-checker-api/internal/snapshot"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
 )
 
 type Server struct {
@@ -27,52 +32,25 @@ type Server struct {
 	metrics     *metrics.Collector
 	aggregator  *aggregator.Aggregator
 	checker     *checker.Checker
+	cycles      *cycle.Runner
 	router      *gin.Engine
 	httpServer  *http.Server
-	rateLimiter *RateLimiter
-}
+	rateLimiter ratelimit.Limiter
+	keys        *auth.Registry
 
-type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
-}
+	// Live copy of the API settings that can change on config reload
+	apiConfig atomic.Pointer[config.APIConfig]
 
-func NewRateLimiter(requestsPerMinute int) *RateLimiter {
-	rps := float64(requestsPerMinute) / 60.0
-	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		rate:     rate.Limit(rps),
-		burst:    requestsPerMinute / 10, // Allow bursts
-	}
+	// /speedtest downloads in progress
+	speedtests atomic.Int64
 }
 
-func (rl *RateLimiter) GetLimiter(key string) *rate.Limiter {
-	rl.mu.RLock()
-	limiter, exists := rl.limiters[key]
-	rl.mu.RUnlock()
-
-	if exists {
-		return limiter
-	}
-
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	// Double-check after acquiring write lock
-	if limiter, exists := rl.limiters[key]; exists {
-		return limiter
-	}
-
-	limiter = rate.NewLimiter(rl.rate, rl.burst)
-	rl.limiters[key] = limiter
-
-	return limiter
-}
+// Context key under which authMiddleware stores the authenticated *auth.Key
+const apiKeyContextKey = "apiKey"
 
 func NewServer(cfg *config.Config, snap *snapshot.Manager, metricsCollector *metrics.Collector,
-	agg *aggregator.Aggregator, chk *checker.Checker) *Server {
+	agg *aggregator.Aggregator, chk *checker.Checker, keys *auth.Registry,
+	limiter ratelimit.Limiter, runner *cycle.Runner) *Server {
 
 	if cfg.Logging.Level == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -89,9 +67,13 @@ func NewServer(cfg *config.Config, snap *snapshot.Manager, metricsCollector *met
 		metrics:     metricsCollector,
 		aggregator:  agg,
 		checker:     chk,
+		cycles:      runner,
 		router:      router,
-		rateLimiter: NewRateLimiter(cfg.API.RateLimitPerMinute),
+		rateLimiter: limiter,
+		keys:        keys,
 	}
+	apiCfg := cfg.API
+	s.apiConfig.Store(&apiCfg)
 
 	s.setupRoutes()
 
@@ -105,6 +87,7 @@ func (s *Server) setupRoutes() {
 
 	// Public endpoints
 	s.router.GET("/health", s.handleHealth)
+	s.router.GET("/speedtest", s.speedtestLimitMiddleware(), s.handleSpeedtest)
 
 	// Metrics endpoint (usually scraped by Prometheus)
 	if s.config.Metrics.Enabled {
@@ -113,16 +96,34 @@ func (s *Server) setupRoutes() {
 
 	// Protected endpoints
 	protected := s.router.Group("/")
-	if s.config.API.EnableAPIKeyAuth {
-		protected.Use(s.authMiddleware())
-	}
-	if s.config.API.EnableIPRateLimit {
-		protected.Use(s.rateLimitMiddleware())
-	}
+	protected.Use(s.authMiddleware(s.config.API.EnableAPIKeyAuth))
+	protected.Use(s.rateLimitMiddleware())
+
+	protected.GET("/get-proxy", s.requireScope(auth.ScopeRead), s.handleGetProxy)
+	protected.GET("/stat", s.requireScope(auth.ScopeRead), s.handleStat)
+	protected.GET("/check", s.requireScope(auth.ScopeCheck), s.handleCheck)
+	protected.POST("/ingest", s.requireScope(auth.ScopeIngest), s.handleIngest)
+	protected.POST("/reload", s.requireScope(auth.ScopeAdmin), s.handleReload)
+	protected.GET("/cycles", s.requireScope(auth.ScopeRead), s.handleListCycles)
+	protected.GET("/cycles/:id", s.requireScope(auth.ScopeRead), s.handleGetCycle)
+
+	admin := protected.Group("/admin", s.requireScope(auth.ScopeAdmin))
+	admin.GET("/keys", s.handleListKeys)
+	admin.POST("/keys", s.handleCreateKey)
+	admin.POST("/keys/:name/rotate", s.handleRotateKey)
+	admin.DELETE("/keys/:name", s.handleRevokeKey)
+	admin.GET("/sources", s.handleListSources)
+	admin.POST("/sources", s.handleCreateSource)
+	admin.PATCH("/sources/:name", s.handleUpdateSource)
+	admin.DELETE("/sources/:name", s.handleDeleteSource)
+}
 
-	protected.GET("/get-proxy", s.handleGetProxy)
-	protected.GET("/stat", s.handleStat)
-	protected.POST("/reload", s.handleReload)
+// UpdateConfig applies reloaded API settings (rate limits). Listener, auth
+// and backend settings only take effect after a restart.
+func (s *Server) UpdateConfig(cfg config.APIConfig) {
+	s.apiConfig.Store(&cfg)
+	log.Infof("API config updated: rate_limit_per_minute=%d, ip_rate_limit=%t",
+		cfg.RateLimitPerMinute, cfg.EnableIPRateLimit)
 }
 
 func (s *Server) Start() error {
@@ -140,6 +141,7 @@ func (s *Server) Start() error {
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	log.Info("Shutting down API server...")
+	defer s.rateLimiter.Close()
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -181,28 +183,72 @@ func (s *Server) metricsMiddleware() gin.HandlerFunc {
 	}
 }
 
-func (s *Server) authMiddleware() gin.HandlerFunc {
-	expectedKey := os.Getenv(s.config.API.APIKeyEnv)
-	if expectedKey == "" {
-		log.Warn("API key not set in environment, authentication disabled")
+// authMiddleware authenticates the request's API key. When required is
+// false (enable_api_key_auth off) requests without a key pass, so only
+// scopes that always need a key are enforced.
+func (s *Server) authMiddleware(required bool) gin.HandlerFunc {
+	if required && s.keys.Len() == 0 {
+		log.Warn("No API keys configured, protected endpoints are refused until one is set via api_key_env")
 	}
 
 	return func(c *gin.Context) {
-		if expectedKey == "" {
-			c.Next()
-			return
-		}
-
 		// Check header first
 		apiKey := c.GetHeader("X-Api-Key")
 		if apiKey == "" {
 			// Check query parameter
 			apiKey = c.Query("key")
 		}
+		if !required && apiKey == "" {
+			c.Next()
+			return
+		}
 
-		if apiKey != expectedKey {
+		// Fail closed: an empty registry must not open the API, or the
+		// first caller could mint an admin key
+		if s.keys.Len() == 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid or missing API key",
+				"error": "No API keys configured",
+			})
+			c.Abort()
+			return
+		}
+
+		key, err := s.keys.Authenticate(apiKey)
+		if err != nil {
+			message := "Invalid or missing API key"
+			if errors.Is(err, auth.ErrKeyExpired) {
+				message = "API key expired"
+			} else if errors.Is(err, auth.ErrKeyRevoked) {
+				message = "API key revoked"
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": message,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// requireScope rejects authenticated requests whose key lacks scope. When
+// authentication is disabled requests are let through, except to admin
+// endpoints, which always need a key.
+func (s *Server) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := requestKey(c)
+		if key == nil && scope == auth.ScopeAdmin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Admin endpoints require an API key",
+			})
+			c.Abort()
+			return
+		}
+		if key != nil && !key.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("API key lacks the %q scope", scope),
 			})
 			c.Abort()
 			return
@@ -214,10 +260,29 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 
 func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		limiter := s.rateLimiter.GetLimiter(ip)
+		var bucket string
+		var perMinute int
+
+		// Keys with their own limit are throttled per key, everyone else per IP
+		if key := requestKey(c); key != nil && key.RateLimitPerMinute > 0 {
+			bucket, perMinute = "key:"+key.Name, key.RateLimitPerMinute
+		} else if apiCfg := s.apiConfig.Load(); apiCfg.EnableIPRateLimit {
+			bucket, perMinute = "ip:"+c.ClientIP(), apiCfg.RateLimitPerMinute
+		}
+
+		if bucket == "" {
+			c.Next()
+			return
+		}
+
+		allowed, err := s.rateLimiter.Allow(c.Request.Context(), bucket, perMinute)
+		if err != nil {
+			// Fail open: a limiter outage should not take the API down
+			log.Warnf("Rate limiter error: %v", err)
+			allowed = true
+		}
 
-		if !limiter.Allow() {
+		if !allowed {
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "Rate limit exceeded",
 			})
@@ -229,6 +294,16 @@ func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
 	}
 }
 
+// requestKey returns the API key that authenticated the request, if any
+func requestKey(c *gin.Context) *auth.Key {
+	value, exists := c.Get(apiKeyContextKey)
+	if !exists {
+		return nil
+	}
+	key, _ := value.(*auth.Key)
+	return key
+}
+
 // Handlers
 
 func (s *Server) handleHealth(c *gin.Context) {
@@ -246,25 +321,95 @@ func (s *Server) handleGetProxy(c *gin.Context) {
 
 	// Parse parameters
 	all := c.Query("all") == "1"
+	distinct := c.Query("distinct_egress") == "1"
+	sortBy := c.Query("sort")
 	limitStr := c.Query("limit")
 	format := c.Query("format")
 	acceptHeader := c.GetHeader("Accept")
 
 	wantsJSON := format == "json" || strings.Contains(acceptHeader, "application/json")
 
-	var proxies []snapshot.Proxy
-
-	if all {
-		proxies = s.snapshot.GetAll()
-	} else if limitStr != "" {
-		limit, err := strconv.Atoi(limitStr)
-		if err != nil || limit < 1 {
+	limit := 0
+	if limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid limit parameter",
 			})
 			return
 		}
-		proxies = s.snapshot.GetProxies(limit)
+	}
+	if sortBy != "" && sortBy != "p90" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid sort parameter (supported: p90)",
+		})
+		return
+	}
+
+	// Filters restrict the pool to matching proxies
+	match, err := proxyFilter(c, s.checker.Config().Targets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	var pool []snapshot.Proxy
+	if match != nil {
+		pool = s.snapshot.Filter(match)
+		if len(pool) == 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "No alive proxies match the requested filters",
+			})
+			return
+		}
+	}
+
+	var proxies []snapshot.Proxy
+
+	if sortBy == "p90" {
+		// Fastest first instead of rotating
+		proxies = pool
+		if proxies == nil {
+			proxies = s.snapshot.GetAll()
+		}
+		sort.SliceStable(proxies, func(a, b int) bool {
+			return proxies[a].P90() < proxies[b].P90()
+		})
+		n := limit
+		if n == 0 && !all {
+			n = 1
+		}
+		if distinct {
+			proxies = distinctEgress(proxies, n)
+		} else if n > 0 && n < len(proxies) {
+			proxies = proxies[:n]
+		}
+	} else if all {
+		if pool != nil {
+			proxies = pool
+		} else {
+			proxies = s.snapshot.GetAll()
+		}
+		if distinct {
+			proxies = distinctEgress(shuffled(proxies), 0)
+		}
+	} else if limitStr != "" {
+		switch {
+		case distinct:
+			from := pool
+			if from == nil {
+				from = snap.Proxies
+			}
+			// Random order spreads requests across each egress group
+			proxies = distinctEgress(shuffled(from), limit)
+		case pool != nil:
+			proxies = s.snapshot.Select(pool, limit)
+		default:
+			proxies = s.snapshot.GetProxies(limit)
+		}
+	} else if pool != nil {
+		proxies = s.snapshot.Select(pool, 1)
 	} else {
 		// Default: return single proxy
 		proxy, ok := s.snapshot.GetProxy()
@@ -277,89 +422,309 @@ func (s *Server) handleGetProxy(c *gin.Context) {
 		proxies = []snapshot.Proxy{proxy}
 	}
 
+	// Enforce the key's daily proxy quota
+	if key := requestKey(c); key != nil && key.DailyProxyQuota > 0 {
+		granted := s.keys.ConsumeQuota(key, len(proxies))
+		if granted == 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Daily proxy quota exceeded",
+			})
+			return
+		}
+		proxies = proxies[:granted]
+		c.Header("X-Quota-Remaining", strconv.Itoa(s.keys.QuotaRemaining(key)))
+	}
+
+	// Credentials only go to authenticated keys allowed to see them
+	if key := requestKey(c); key == nil || !key.HasScope(auth.ScopeCredentials) {
+		redacted := make([]snapshot.Proxy, len(proxies))
+		for i, p := range proxies {
+			redacted[i] = p.WithoutCredentials()
+		}
+		proxies = redacted
+	}
+
 	if wantsJSON {
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"total":   len(snap.Proxies),
 			"alive":   snap.Stats.TotalAlive,
 			"proxies": proxies,
-		})
+		}
+		if pool != nil {
+			response["matched"] = len(pool)
+		}
+		c.JSON(http.StatusOK, response)
 	} else {
 		// Plain text format (one per line)
 		var result strings.Builder
 		for _, p := range proxies {
-			result.WriteString(p.Address)
+			result.WriteString(proxyLine(p))
 			result.WriteString("\n")
 		}
 		c.String(http.StatusOK, result.String())
 	}
 }
 
+// proxyFilter builds the /get-proxy filter from the query, or nil when
+// there is none: source lists the sources a proxy must come from, country
+// and asn its GeoIP location and network, exclude_country and exclude_asn
+// what it must not be in, max_p90_ms its highest p90 latency, min_kbps
+// its lowest measured throughput and works_for the target profiles it must
+// have passed at their last check
+func proxyFilter(c *gin.Context, profiles []config.TargetProfile) (func(snapshot.Proxy) bool, error) {
+	var checks []func(snapshot.Proxy) bool
+
+	if targets := splitList(c.Query("works_for")); len(targets) > 0 {
+		for _, target := range targets {
+			known := slices.ContainsFunc(profiles, func(profile config.TargetProfile) bool {
+				return profile.Name == target
+			})
+			if !known {
+				return nil, fmt.Errorf("unknown target profile %q", target)
+			}
+		}
+		checks = append(checks, func(p snapshot.Proxy) bool {
+			return p.WorksFor(targets...)
+		})
+	}
+
+	if value := c.Query("max_p90_ms"); value != "" {
+		maxP90, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxP90 < 1 {
+			return nil, fmt.Errorf("invalid max_p90_ms %q", value)
+		}
+		checks = append(checks, func(p snapshot.Proxy) bool {
+			return p.P90() <= maxP90
+		})
+	}
+
+	if value := c.Query("min_kbps"); value != "" {
+		minKbps, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || minKbps < 1 {
+			return nil, fmt.Errorf("invalid min_kbps %q", value)
+		}
+		// Proxies that were not measured never match
+		checks = append(checks, func(p snapshot.Proxy) bool {
+			return p.BytesPerSec > 0 && p.Kbps() >= minKbps
+		})
+	}
+
+	if sources := splitList(c.Query("source")); len(sources) > 0 {
+		checks = append(checks, func(p snapshot.Proxy) bool {
+			return p.HasSource(sources...)
+		})
+	}
+
+	for _, param := range []string{"country", "exclude_country"} {
+		countries := splitList(strings.ToUpper(c.Query(param)))
+		if len(countries) == 0 {
+			continue
+		}
+		exclude := param == "exclude_country"
+		checks = append(checks, func(p snapshot.Proxy) bool {
+			return slices.Contains(countries, p.Country) != exclude
+		})
+	}
+
+	for _, param := range []string{"asn", "exclude_asn"} {
+		var asns []uint
+		for _, item := range splitList(c.Query(param)) {
+			asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(item), "AS"), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", param, item)
+			}
+			asns = append(asns, uint(asn))
+		}
+		if len(asns) == 0 {
+			continue
+		}
+		exclude := param == "exclude_asn"
+		checks = append(checks, func(p snapshot.Proxy) bool {
+			return slices.Contains(asns, p.ASN) != exclude
+		})
+	}
+
+	if len(checks) == 0 {
+		return nil, nil
+	}
+	return func(p snapshot.Proxy) bool {
+		for _, check := range checks {
+			if !check(p) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// distinctEgress keeps the first proxy of each egress address, up to n
+// proxies (all when n is 0)
+func distinctEgress(proxies []snapshot.Proxy, n int) []snapshot.Proxy {
+	seen := make(map[string]bool)
+	result := make([]snapshot.Proxy, 0)
+	for _, p := range proxies {
+		if n > 0 && len(result) == n {
+			break
+		}
+		if egress := p.Egress(); !seen[egress] {
+			seen[egress] = true
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// shuffled returns the proxies in random order
+func shuffled(proxies []snapshot.Proxy) []snapshot.Proxy {
+	result := make([]snapshot.Proxy, len(proxies))
+	for i, j := range rand.Perm(len(proxies)) {
+		result[i] = proxies[j]
+	}
+	return result
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// proxyLine formats a proxy for plain-text output. Plain HTTP proxies stay
+// bare host:port for compatibility; other protocols and proxies with
+// credentials are written as URLs.
+func proxyLine(p snapshot.Proxy) string {
+	if p.HasCredentials() {
+		return p.Candidate().URL().String()
+	}
+	if p.Protocol == "" || p.Protocol == "http" {
+		return p.Address
+	}
+	return p.Protocol + "://" + p.Address
+}
+
 func (s *Server) handleStat(c *gin.Context) {
 	stats := s.snapshot.GetStats()
 	snap := s.snapshot.Get()
 
 	response := gin.H{
-		"total_scraped": stats.TotalScraped,
-		"total_alive":   stats.TotalAlive,
-		"total_dead":    stats.TotalDead,
-		"alive_percent": fmt.Sprintf("%.2f%%", stats.AlivePercent),
-		"last_check":    stats.LastCheckTime.Format(time.RFC3339),
-		"updated":       snap.Updated.Format(time.RFC3339),
+		"total_scraped":   stats.TotalScraped,
+		"total_alive":     stats.TotalAlive,
+		"total_dead":      stats.TotalDead,
+		"alive_percent":   fmt.Sprintf("%.2f%%", stats.AlivePercent),
+		"distinct_egress": stats.DistinctEgress,
+		"last_check":      stats.LastCheckTime.Format(time.RFC3339),
+		"updated":         snap.Updated.Format(time.RFC3339),
 	}
 
 	if stats.SourceStats != nil {
 		response["sources"] = stats.SourceStats
 	}
+	if len(stats.BySource) > 0 {
+		response["by_source"] = stats.BySource
+	}
+	if len(stats.Filtered) > 0 {
+		response["filtered"] = stats.Filtered
+	}
+	if health := s.aggregator.Health(); len(health) > 0 {
+		response["source_health"] = health
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-func (s *Server) handleReload(c *gin.Context) {
-	log.Info("Manual reload triggered via API")
-
-	go func() {
-		ctx := context.Background()
+func (s *Server) handleCheck(c *gin.Context) {
+	proxyAddr := strings.TrimSpace(c.Query("proxy"))
+	if proxyAddr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing proxy parameter",
+		})
+		return
+	}
 
-		// Re-aggregate
-		proxies, sourceStats, err := s.aggregator.Aggregate(ctx)
-		if err != nil {
-			log.Errorf("Reload aggregation failed: %v", err)
-			return
-		}
+	candidate, ok := aggregator.ParseProxyAddress(proxyAddr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid proxy address",
+		})
+		return
+	}
 
-		// Re-check
-		results := s.checker.CheckProxies(ctx, proxies)
+	// The same rules as aggregated candidates. This rejects the request
+	// early with a reason; the checker applies the address rules again to
+	// the address it connects to, which a hostname may have changed since.
+	reason, err := s.aggregator.FilterReason(c.Request.Context(), candidate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Proxy address rejected by filter",
+			"reason": reason,
+		})
+		return
+	}
 
-		aliveCount := 0
-		aliveProxies := make([]snapshot.Proxy, 0)
+	result := s.checker.CheckSingle(c.Request.Context(), candidate)
+	c.JSON(http.StatusOK, gin.H{
+		"proxy":      result.Proxy,
+		"protocol":   candidate.Scheme(),
+		"alive":      result.Alive,
+		"latency_ms": result.LatencyMs,
+		"samples":    result.Samples,
+		"timing":     result.Timing,
+		"exit_ip":    result.ExitIP,
+		"error":      result.Error,
+	})
+}
 
-		for _, result := range results {
-			if result.Alive {
-				aliveCount++
-				aliveProxies = append(aliveProxies, snapshot.Proxy{
-					Address:   result.Proxy,
-					Alive:     true,
-					LatencyMs: result.LatencyMs,
-					LastCheck: time.Now(),
-				})
-			}
+func (s *Server) handleReload(c *gin.Context) {
+	id, started := s.cycles.Trigger("api")
+	if !started {
+		// ?coalesce=0 asks to be told about the conflict instead of joining
+		if c.Query("coalesce") == "0" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":    "A cycle is already running",
+				"cycle_id": id,
+			})
+			return
 		}
 
-		stats := snapshot.Stats{
-			TotalScraped:  len(proxies),
-			TotalAlive:    aliveCount,
-			TotalDead:     len(proxies) - aliveCount,
-			AlivePercent:  float64(aliveCount) / float64(len(proxies)) * 100.0,
-			LastCheckTime: time.Now(),
-			SourceStats:   sourceStats,
-		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Cycle already running",
+			"cycle_id": id,
+		})
+		return
+	}
 
-		s.snapshot.Update(aliveProxies, stats)
-		log.Info("Reload complete")
-	}()
+	log.Infof("Manual reload triggered via API (cycle %s)", id)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Reload triggered",
+		"cycle_id": id,
+	})
+}
 
+func (s *Server) handleListCycles(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Reload triggered",
+		"cycles": s.cycles.List(),
 	})
 }
 
+func (s *Server) handleGetCycle(c *gin.Context) {
+	cyc, ok := s.cycles.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Cycle not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, cyc)
+}
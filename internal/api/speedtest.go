@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// speedtestPerIPPerMinute caps /speedtest downloads per client IP, with a
+// burst of 6. A probe fetches it once per proxy and cycle, so only proxies
+// sharing an exit IP come close.
+const speedtestPerIPPerMinute = 60
+
+// speedtestBlock is repeated to build the bandwidth payload. It is random so
+// proxies that compress traffic cannot inflate the measured throughput.
+var speedtestBlock = func() []byte {
+	block := make([]byte, 64*1024)
+	rand.Read(block)
+	return block
+}()
+
+// speedtestLimitMiddleware guards the public /speedtest: no more downloads
+// at once than the probe runs in parallel, and a few per IP and minute
+func (s *Server) speedtestLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := s.checker.Config().Bandwidth
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		if s.speedtests.Add(1) > int64(cfg.Concurrency) {
+			s.speedtests.Add(-1)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many speedtest downloads in progress",
+			})
+			c.Abort()
+			return
+		}
+		defer s.speedtests.Add(-1)
+
+		allowed, err := s.rateLimiter.Allow(c.Request.Context(), "speedtest:"+c.ClientIP(), speedtestPerIPPerMinute)
+		if err != nil {
+			// Fail open like the API limiter; the concurrency cap still holds
+			log.Warnf("Rate limiter error: %v", err)
+			allowed = true
+		}
+		if !allowed {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Rate limit exceeded",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// handleSpeedtest serves checker.bandwidth.bytes of incompressible data as
+// a bandwidth probe target. It is public because proxies fetch it, and
+// only served while the probe is enabled.
+func (s *Server) handleSpeedtest(c *gin.Context) {
+	cfg := s.checker.Config().Bandwidth
+	if !cfg.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Bandwidth probe is disabled",
+		})
+		return
+	}
+
+	// Slow proxies take up to the probe timeout, far longer than the
+	// server's write timeout allows other responses
+	deadline := time.Now().Add(time.Duration(cfg.TimeoutMs)*time.Millisecond + 5*time.Second)
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+		log.Debugf("Cannot extend speedtest write deadline: %v", err)
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(cfg.Bytes, 10))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	for remaining := cfg.Bytes; remaining > 0; {
+		chunk := speedtestBlock
+		if remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		if _, err := c.Writer.Write(chunk); err != nil {
+			return
+		}
+		remaining -= int64(len(chunk))
+	}
+}
@@ -0,0 +1,627 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scopes grantable to an API key
+const (
+	ScopeRead        = "read"        // /get-proxy, /stat
+	ScopeCheck       = "check"       // on-demand proxy checks
+	ScopeIngest      = "ingest"      // POST /ingest
+	ScopeCredentials = "credentials" // proxy credentials in /get-proxy output
+	ScopeAdmin       = "admin"       // /reload and /admin/*
+)
+
+var (
+	ErrInvalidKey   = errors.New("invalid API key")
+	ErrKeyExpired   = errors.New("API key expired")
+	ErrKeyRevoked   = errors.New("API key revoked")
+	ErrKeyNotFound  = errors.New("API key not found")
+	ErrKeyExists    = errors.New("API key already exists")
+	ErrInvalidScope = errors.New("unknown scope")
+
+	validScopes = map[string]bool{ScopeRead: true, ScopeCheck: true, ScopeIngest: true, ScopeCredentials: true, ScopeAdmin: true}
+	nameRegex   = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+)
+
+// Key is a named API key. Only the SHA-256 hash of the secret is kept.
+type Key struct {
+	Name               string     `json:"name"`
+	Hash               string     `json:"hash,omitempty"`
+	SecretEnv          string     `json:"secret_env,omitempty"` // hand-written files may reference an env var instead of a hash
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute,omitempty"`
+	DailyProxyQuota    int        `json:"daily_proxy_quota,omitempty"`
+	DailyIngestQuota   int        `json:"daily_ingest_quota,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	Revoked            bool       `json:"revoked,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	RotatedAt          *time.Time `json:"rotated_at,omitempty"`
+
+	static bool // bootstrap key from the environment, never persisted
+
+	// secretHash is what Authenticate compares against: Hash, or the hash of
+	// the secret_env variable, which is never written back as Hash. Empty
+	// when the key has no usable secret.
+	secretHash string
+}
+
+// Disabled reports whether the key has no usable secret, e.g. because its
+// secret_env variable is empty
+func (k *Key) Disabled() bool {
+	return k.secretHash == ""
+}
+
+// HasScope reports whether the key was granted scope. Admin implies every scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore persists the key registry and the keys' daily quota usage
+type KeyStore interface {
+	LoadKeys() ([]Key, error)
+	SaveKeys(keys []Key) error
+	LoadUsage() (map[string]*DailyUsage, error)
+	SaveUsage(usage map[string]*DailyUsage) error
+}
+
+// FileKeyStore keeps keys in a standalone JSON file, and their usage in a
+// .usage file next to it
+type FileKeyStore struct {
+	path string
+}
+
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{path: path}
+}
+
+func (f *FileKeyStore) LoadKeys() ([]Key, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read keys file: %w", err)
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse keys file: %w", err)
+	}
+	return keys, nil
+}
+
+func (f *FileKeyStore) SaveKeys(keys []Key) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal keys: %w", err)
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+func (f *FileKeyStore) LoadUsage() (map[string]*DailyUsage, error) {
+	data, err := os.ReadFile(f.path + ".usage")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read usage file: %w", err)
+	}
+
+	var usage map[string]*DailyUsage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, fmt.Errorf("parse usage file: %w", err)
+	}
+	return usage, nil
+}
+
+func (f *FileKeyStore) SaveUsage(usage map[string]*DailyUsage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("marshal usage: %w", err)
+	}
+	return writeFileAtomic(f.path+".usage", data)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("atomic rename: %w", err)
+	}
+	return nil
+}
+
+// StorageKeyStore keeps keys in the configured storage backend
+type StorageKeyStore struct {
+	store storage.Storage
+}
+
+const (
+	keysBlobName  = "api_keys"
+	usageBlobName = "api_key_usage"
+)
+
+func NewStorageKeyStore(store storage.Storage) *StorageKeyStore {
+	return &StorageKeyStore{store: store}
+}
+
+func (s *StorageKeyStore) LoadKeys() ([]Key, error) {
+	data, err := s.store.LoadBlob(keysBlobName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse stored keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *StorageKeyStore) SaveKeys(keys []Key) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("marshal keys: %w", err)
+	}
+	return s.store.SaveBlob(keysBlobName, data)
+}
+
+func (s *StorageKeyStore) LoadUsage() (map[string]*DailyUsage, error) {
+	data, err := s.store.LoadBlob(usageBlobName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var usage map[string]*DailyUsage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, fmt.Errorf("parse stored usage: %w", err)
+	}
+	return usage, nil
+}
+
+func (s *StorageKeyStore) SaveUsage(usage map[string]*DailyUsage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("marshal usage: %w", err)
+	}
+	return s.store.SaveBlob(usageBlobName, data)
+}
+
+// usageFlushInterval is how often changed quota usage is persisted
+const usageFlushInterval = 30 * time.Second
+
+// DailyUsage counts what a key consumed of its daily quotas
+type DailyUsage struct {
+	Day      string `json:"day"` // UTC, YYYY-MM-DD
+	Proxies  int    `json:"proxies"`
+	Ingested int    `json:"ingested"`
+}
+
+// Registry holds all API keys and their daily usage
+type Registry struct {
+	mu         sync.RWMutex
+	keys       map[string]*Key
+	usage      map[string]*DailyUsage
+	usageDirty bool // usage changed since it was last persisted
+	store      KeyStore
+}
+
+// NewRegistry loads keys from store
+func NewRegistry(store KeyStore) (*Registry, error) {
+	r := &Registry{
+		keys:  make(map[string]*Key),
+		usage: make(map[string]*DailyUsage),
+		store: store,
+	}
+
+	keys, err := store.LoadKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys without a usable secret stay registered, disabled, so saving the
+	// registry writes them back as loaded
+	for i := range keys {
+		key := keys[i]
+		switch {
+		case key.SecretEnv != "":
+			// The variable is the source of truth; a hash saved next to it
+			// by older versions is dropped
+			key.Hash = ""
+			if secret := os.Getenv(key.SecretEnv); secret != "" {
+				key.secretHash = hashSecret(secret)
+			} else {
+				log.Warnf("API key %q: environment variable %s is empty, key disabled", key.Name, key.SecretEnv)
+			}
+		case key.Hash != "":
+			key.secretHash = key.Hash
+		default:
+			log.Warnf("API key %q has no hash or secret_env, key disabled", key.Name)
+		}
+		r.keys[key.Name] = &key
+	}
+
+	usage, err := store.LoadUsage()
+	if err != nil {
+		// Quotas restart from zero rather than locking keys out
+		log.Warnf("Failed to load API key usage: %v", err)
+	}
+	for name, u := range usage {
+		if u != nil {
+			r.usage[name] = u
+		}
+	}
+
+	log.Infof("Loaded %d API keys", len(r.keys))
+	return r, nil
+}
+
+// AddStatic registers a key that lives only in memory (e.g. the legacy
+// single key read from the environment)
+func (r *Registry) AddStatic(name, secret string, scopes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash := hashSecret(secret)
+	r.keys[name] = &Key{
+		Name:       name,
+		Hash:       hash,
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+		static:     true,
+		secretHash: hash,
+	}
+}
+
+// Len returns the number of registered keys, including revoked ones
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.keys)
+}
+
+// Authenticate resolves a presented secret to its key. Every stored hash is
+// compared in constant time so the lookup does not leak which keys exist.
+func (r *Registry) Authenticate(secret string) (*Key, error) {
+	presented := []byte(hashSecret(secret))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var match *Key
+	for _, key := range r.keys {
+		if subtle.ConstantTimeCompare(presented, []byte(key.secretHash)) == 1 && !key.Disabled() {
+			match = key
+		}
+	}
+
+	if match == nil {
+		return nil, ErrInvalidKey
+	}
+	if match.Revoked {
+		return nil, ErrKeyRevoked
+	}
+	if match.ExpiresAt != nil && time.Now().After(*match.ExpiresAt) {
+		return nil, ErrKeyExpired
+	}
+
+	key := *match
+	return &key, nil
+}
+
+// List returns all keys sorted by name
+func (r *Registry) List() []Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// Create registers a new key and returns its plaintext secret, which is not
+// stored and cannot be recovered later
+func (r *Registry) Create(spec Key) (Key, string, error) {
+	if !nameRegex.MatchString(spec.Name) {
+		return Key{}, "", fmt.Errorf("invalid key name %q", spec.Name)
+	}
+	if err := validateScopes(spec.Scopes); err != nil {
+		return Key{}, "", err
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.keys[spec.Name]; exists {
+		return Key{}, "", ErrKeyExists
+	}
+
+	hash := hashSecret(secret)
+	key := Key{
+		Name:               spec.Name,
+		Hash:               hash,
+		Scopes:             spec.Scopes,
+		RateLimitPerMinute: spec.RateLimitPerMinute,
+		DailyProxyQuota:    spec.DailyProxyQuota,
+		DailyIngestQuota:   spec.DailyIngestQuota,
+		ExpiresAt:          spec.ExpiresAt,
+		CreatedAt:          time.Now(),
+		secretHash:         hash,
+	}
+	r.keys[key.Name] = &key
+
+	if err := r.saveLocked(); err != nil {
+		delete(r.keys, key.Name)
+		return Key{}, "", err
+	}
+
+	log.Infof("API key %q created with scopes %v", key.Name, key.Scopes)
+	return key, secret, nil
+}
+
+// Rotate replaces the secret of an existing key
+func (r *Registry) Rotate(name string) (Key, string, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[name]
+	if !exists || key.static {
+		return Key{}, "", ErrKeyNotFound
+	}
+
+	// A rotated env-backed key turns into a stored-hash key
+	previous := *key
+	now := time.Now()
+	key.Hash = hashSecret(secret)
+	key.secretHash = key.Hash
+	key.SecretEnv = ""
+	key.RotatedAt = &now
+
+	if err := r.saveLocked(); err != nil {
+		*key = previous
+		return Key{}, "", err
+	}
+
+	log.Infof("API key %q rotated", name)
+	return *key, secret, nil
+}
+
+// Revoke permanently disables a key. The record is kept for auditing.
+func (r *Registry) Revoke(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[name]
+	if !exists || key.static {
+		return ErrKeyNotFound
+	}
+
+	key.Revoked = true
+	if err := r.saveLocked(); err != nil {
+		key.Revoked = false
+		return err
+	}
+
+	log.Infof("API key %q revoked", name)
+	return nil
+}
+
+// ConsumeQuota reserves up to n proxies from the key's daily quota and
+// returns how many were granted
+func (r *Registry) ConsumeQuota(key *Key, n int) int {
+	if key.DailyProxyQuota <= 0 {
+		return n
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage := r.usageLocked(key)
+	remaining := key.DailyProxyQuota - usage.Proxies
+	if remaining <= 0 {
+		return 0
+	}
+	if n > remaining {
+		n = remaining
+	}
+	usage.Proxies += n
+	r.usageDirty = true
+	return n
+}
+
+// QuotaRemaining returns how many proxies the key may still fetch today,
+// or -1 for unlimited keys
+func (r *Registry) QuotaRemaining(key *Key) int {
+	if key.DailyProxyQuota <= 0 {
+		return -1
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	usage, exists := r.usage[key.Name]
+	if !exists || usage.Day != today {
+		return key.DailyProxyQuota
+	}
+	if usage.Proxies >= key.DailyProxyQuota {
+		return 0
+	}
+	return key.DailyProxyQuota - usage.Proxies
+}
+
+// ConsumeIngestQuota reserves up to n candidates from the key's daily
+// ingestion quota and returns how many were granted
+func (r *Registry) ConsumeIngestQuota(key *Key, n int) int {
+	if key.DailyIngestQuota <= 0 {
+		return n
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage := r.usageLocked(key)
+	remaining := key.DailyIngestQuota - usage.Ingested
+	if remaining <= 0 {
+		return 0
+	}
+	if n > remaining {
+		n = remaining
+	}
+	usage.Ingested += n
+	r.usageDirty = true
+	return n
+}
+
+// RefundIngestQuota gives back n candidates taken by ConsumeIngestQuota
+// for a push that was then refused
+func (r *Registry) RefundIngestQuota(key *Key, n int) {
+	if key.DailyIngestQuota <= 0 || n <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage := r.usageLocked(key)
+	usage.Ingested = max(usage.Ingested-n, 0)
+	r.usageDirty = true
+}
+
+// usageLocked returns today's usage record for key, starting a new one at
+// the UTC day boundary
+func (r *Registry) usageLocked(key *Key) *DailyUsage {
+	today := time.Now().UTC().Format("2006-01-02")
+
+	usage, exists := r.usage[key.Name]
+	if !exists || usage.Day != today {
+		usage = &DailyUsage{Day: today}
+		r.usage[key.Name] = usage
+	}
+	return usage
+}
+
+// PersistUsage saves changed quota usage every 30s until ctx is done, so
+// daily quotas survive restarts; call FlushUsage on shutdown for the rest
+func (r *Registry) PersistUsage(ctx context.Context) {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.FlushUsage(); err != nil {
+				log.Errorf("Failed to persist API key usage: %v", err)
+			}
+		}
+	}
+}
+
+// FlushUsage saves quota usage if it changed since the last save
+func (r *Registry) FlushUsage() error {
+	r.mu.Lock()
+	if !r.usageDirty {
+		r.mu.Unlock()
+		return nil
+	}
+	usage := make(map[string]*DailyUsage, len(r.usage))
+	for name, u := range r.usage {
+		copied := *u
+		usage[name] = &copied
+	}
+	r.usageDirty = false
+	r.mu.Unlock()
+
+	if err := r.store.SaveUsage(usage); err != nil {
+		r.mu.Lock()
+		r.usageDirty = true
+		r.mu.Unlock()
+		return fmt.Errorf("persist usage: %w", err)
+	}
+	return nil
+}
+
+func (r *Registry) saveLocked() error {
+	keys := make([]Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		if !key.static {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+
+	if err := r.store.SaveKeys(keys); err != nil {
+		return fmt.Errorf("persist keys: %w", err)
+	}
+	return nil
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return "pk_" + hex.EncodeToString(buf), nil
+}
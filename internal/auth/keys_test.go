@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeysFile writes raw key records the way an operator would
+func writeKeysFile(t *testing.T, records []map[string]any) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readKeysFile(t *testing.T, path string) map[string]map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]map[string]any, len(records))
+	for _, record := range records {
+		byName[record["name"].(string)] = record
+	}
+	return byName
+}
+
+func TestRegistryEnvBackedKeys(t *testing.T) {
+	t.Setenv("TEST_KEY_SET", "env-secret")
+	t.Setenv("TEST_KEY_EMPTY", "")
+	t.Setenv("TEST_KEY_STALE", "stale-env-secret")
+
+	path := writeKeysFile(t, []map[string]any{
+		{"name": "set", "secret_env": "TEST_KEY_SET", "scopes": []string{"read"}},
+		{"name": "empty", "secret_env": "TEST_KEY_EMPTY", "scopes": []string{"read"}},
+		{"name": "stale", "secret_env": "TEST_KEY_STALE", "hash": hashSecret("old-secret"), "scopes": []string{"read"}},
+		{"name": "hashed", "hash": hashSecret("stored-secret"), "scopes": []string{"check"}},
+	})
+
+	registry, err := NewRegistry(NewFileKeyStore(path))
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	if got := registry.Len(); got != 4 {
+		t.Fatalf("Len() = %d, want 4 (disabled keys stay registered)", got)
+	}
+
+	authTests := []struct {
+		name    string
+		secret  string
+		wantKey string
+	}{
+		{"env secret", "env-secret", "set"},
+		{"env secret over stale hash", "stale-env-secret", "stale"},
+		{"stored hash", "stored-secret", "hashed"},
+		{"stale hash next to secret_env", "old-secret", ""},
+		{"empty secret", "", ""},
+	}
+	for _, tt := range authTests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := registry.Authenticate(tt.secret)
+			if tt.wantKey == "" {
+				if err == nil {
+					t.Errorf("Authenticate(%q) = %q, want error", tt.secret, key.Name)
+				}
+				return
+			}
+			if err != nil || key.Name != tt.wantKey {
+				t.Errorf("Authenticate(%q) = %v, %v; want %q", tt.secret, key, err, tt.wantKey)
+			}
+		})
+	}
+
+	for _, key := range registry.List() {
+		if want := key.Name == "empty"; key.Disabled() != want {
+			t.Errorf("key %q Disabled() = %t, want %t", key.Name, key.Disabled(), want)
+		}
+	}
+
+	// Any write saves env-backed keys as loaded: secret_env, no hash
+	if _, _, err := registry.Create(Key{Name: "new", Scopes: []string{"read"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	saved := readKeysFile(t, path)
+	saveTests := []struct {
+		name      string
+		secretEnv string
+		hasHash   bool
+	}{
+		{"set", "TEST_KEY_SET", false},
+		{"empty", "TEST_KEY_EMPTY", false},
+		{"stale", "TEST_KEY_STALE", false},
+		{"hashed", "", true},
+		{"new", "", true},
+	}
+	for _, tt := range saveTests {
+		t.Run("saved "+tt.name, func(t *testing.T) {
+			record, ok := saved[tt.name]
+			if !ok {
+				t.Fatalf("key %q not saved", tt.name)
+			}
+			secretEnv, _ := record["secret_env"].(string)
+			_, hasHash := record["hash"]
+			if secretEnv != tt.secretEnv || hasHash != tt.hasHash {
+				t.Errorf("saved %q: secret_env %q, hash %t; want %q, %t", tt.name, secretEnv, hasHash, tt.secretEnv, tt.hasHash)
+			}
+		})
+	}
+
+	// After a restart with a changed variable the new secret applies and the
+	// previously empty key comes back
+	t.Setenv("TEST_KEY_SET", "rotated-env-secret")
+	t.Setenv("TEST_KEY_EMPTY", "now-set")
+	reloaded, err := NewRegistry(NewFileKeyStore(path))
+	if err != nil {
+		t.Fatalf("NewRegistry after save: %v", err)
+	}
+	if _, err := reloaded.Authenticate("env-secret"); err == nil {
+		t.Error("old env secret still accepted after the variable changed")
+	}
+	if key, err := reloaded.Authenticate("now-set"); err != nil || key.Name != "empty" {
+		t.Errorf("Authenticate(now-set) = %v, %v; want key \"empty\"", key, err)
+	}
+	if _, err := reloaded.Authenticate("stored-secret"); err != nil {
+		t.Errorf("stored hash lost across save and reload: %v", err)
+	}
+}
+
+func TestRegistryRotateEnvBackedKey(t *testing.T) {
+	t.Setenv("TEST_KEY_ROTATE", "env-secret")
+	path := writeKeysFile(t, []map[string]any{
+		{"name": "k", "secret_env": "TEST_KEY_ROTATE", "scopes": []string{"read"}},
+	})
+
+	registry, err := NewRegistry(NewFileKeyStore(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secret, err := registry.Rotate("k")
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	if _, err := registry.Authenticate("env-secret"); err == nil {
+		t.Error("env secret still accepted after rotation")
+	}
+	if _, err := registry.Authenticate(secret); err != nil {
+		t.Errorf("rotated secret rejected: %v", err)
+	}
+	record := readKeysFile(t, path)["k"]
+	if _, ok := record["secret_env"]; ok || record["hash"] != hashSecret(secret) {
+		t.Errorf("rotated key saved as %v, want the new hash without secret_env", record)
+	}
+}
+
+func TestRefundIngestQuota(t *testing.T) {
+	registry := newTestRegistry(t)
+	key := &Key{Name: "pusher", DailyIngestQuota: 10}
+
+	if got := registry.ConsumeIngestQuota(key, 8); got != 8 {
+		t.Fatalf("ConsumeIngestQuota(8) = %d, want 8", got)
+	}
+	// A refused push gives its share back
+	registry.RefundIngestQuota(key, 8)
+	if got := registry.ConsumeIngestQuota(key, 10); got != 10 {
+		t.Fatalf("ConsumeIngestQuota(10) after refund = %d, want 10", got)
+	}
+	// Refunds never take usage below zero
+	registry.RefundIngestQuota(key, 50)
+	if got := registry.ConsumeIngestQuota(key, 20); got != 10 {
+		t.Errorf("ConsumeIngestQuota(20) after over-refund = %d, want 10", got)
+	}
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	registry, err := NewRegistry(NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json")))
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	return registry
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{"granted", []string{ScopeRead}, ScopeRead, true},
+		{"one of several", []string{ScopeRead, ScopeIngest}, ScopeIngest, true},
+		{"not granted", []string{ScopeRead}, ScopeCheck, false},
+		{"credentials not implied by read", []string{ScopeRead}, ScopeCredentials, false},
+		{"admin implies read", []string{ScopeAdmin}, ScopeRead, true},
+		{"admin implies credentials", []string{ScopeAdmin}, ScopeCredentials, true},
+		{"no scopes", nil, ScopeRead, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := Key{Scopes: tt.scopes}
+			if got := key.HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope(%q) with %v = %t, want %t", tt.scope, tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Key
+		wantErr error
+	}{
+		{"no scopes", Key{Name: "reader"}, nil},
+		{"unknown scope", Key{Name: "reader", Scopes: []string{"write"}}, ErrInvalidScope},
+		{"invalid name", Key{Name: "no spaces", Scopes: []string{ScopeRead}}, nil},
+		{"empty name", Key{Scopes: []string{ScopeRead}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := newTestRegistry(t).Create(tt.spec)
+			if err == nil {
+				t.Fatalf("Create(%+v) succeeded, want error", tt.spec)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create(%+v) error = %v, want %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	registry := newTestRegistry(t)
+	create := func(spec Key) string {
+		t.Helper()
+		_, secret, err := registry.Create(spec)
+		if err != nil {
+			t.Fatalf("Create(%s): %v", spec.Name, err)
+		}
+		return secret
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	valid := create(Key{Name: "valid", Scopes: []string{ScopeRead}})
+	revoked := create(Key{Name: "revoked", Scopes: []string{ScopeRead}})
+	expired := create(Key{Name: "expired", Scopes: []string{ScopeRead}, ExpiresAt: &past})
+	expiring := create(Key{Name: "expiring", Scopes: []string{ScopeRead}, ExpiresAt: &future})
+	if err := registry.Revoke("revoked"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantKey string
+		wantErr error
+	}{
+		{"valid", valid, "valid", nil},
+		{"not yet expired", expiring, "expiring", nil},
+		{"unknown", "pk_unknown", "", ErrInvalidKey},
+		{"empty", "", "", ErrInvalidKey},
+		{"revoked", revoked, "", ErrKeyRevoked},
+		{"expired", expired, "", ErrKeyExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := registry.Authenticate(tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && key.Name != tt.wantKey {
+				t.Errorf("Authenticate = %q, want %q", key.Name, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestConsumeQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     int
+		requests  []int
+		granted   []int
+		remaining int
+	}{
+		{"unlimited", 0, []int{500, 500}, []int{500, 500}, -1},
+		{"within quota", 100, []int{30, 20}, []int{30, 20}, 50},
+		{"capped at the remainder", 100, []int{80, 50}, []int{80, 20}, 0},
+		{"exhausted", 10, []int{10, 1, 5}, []int{10, 0, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestRegistry(t)
+			key := &Key{Name: "reader", DailyProxyQuota: tt.quota}
+			for i, n := range tt.requests {
+				if got := registry.ConsumeQuota(key, n); got != tt.granted[i] {
+					t.Errorf("request %d: ConsumeQuota(%d) = %d, want %d", i, n, got, tt.granted[i])
+				}
+			}
+			if got := registry.QuotaRemaining(key); got != tt.remaining {
+				t.Errorf("QuotaRemaining() = %d, want %d", got, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestConsumeQuotaResetsDaily(t *testing.T) {
+	registry := newTestRegistry(t)
+	key := &Key{Name: "reader", DailyProxyQuota: 10}
+
+	// Yesterday's usage does not count against today
+	registry.usage[key.Name] = &DailyUsage{Day: time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02"), Proxies: 10}
+	if got := registry.QuotaRemaining(key); got != 10 {
+		t.Errorf("QuotaRemaining() = %d, want 10", got)
+	}
+	if got := registry.ConsumeQuota(key, 4); got != 4 {
+		t.Errorf("ConsumeQuota(4) = %d, want 4", got)
+	}
+}
@@ -0,0 +1,131 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// MeasureBandwidth downloads the bandwidth payload through the candidates,
+// or a random sample of them, and returns the throughput in bytes/sec per
+// candidate; 0 means not measured or failed. It returns nil when the probe
+// is disabled.
+func (c *Checker) MeasureBandwidth(ctx context.Context, candidates []types.Candidate) []int64 {
+	state := c.state.Load()
+	cfg := state.config.Bandwidth
+	if !cfg.Enabled || len(candidates) == 0 {
+		return nil
+	}
+
+	indices := rand.Perm(len(candidates))
+	if cfg.SampleSize > 0 && cfg.SampleSize < len(indices) {
+		indices = indices[:cfg.SampleSize]
+	}
+
+	log.Infof("Measuring bandwidth of %d proxies (%d bytes each)", len(indices), cfg.Bytes)
+	start := time.Now()
+
+	// Downloads need more time than checks, so they get their own client
+	client := &http.Client{
+		Transport: state.transport,
+		Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+	}
+
+	speeds := make([]int64, len(candidates))
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for _, i := range indices {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return speeds
+		}
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			speed, err := probeBandwidth(ctx, client, candidates[i], cfg.URL, cfg.Bytes)
+			if err != nil {
+				log.Debugf("Bandwidth probe of %s failed: %v", candidates[i].Address, err)
+				return
+			}
+			speeds[i] = speed
+		}(i)
+	}
+	wg.Wait()
+
+	measured := make([]int64, 0, len(indices))
+	for _, speed := range speeds {
+		if speed > 0 {
+			measured = append(measured, speed)
+		}
+	}
+	if len(measured) > 0 {
+		sort.Slice(measured, func(a, b int) bool { return measured[a] < measured[b] })
+		log.Infof("Bandwidth measured for %d/%d proxies in %v, median %d kbps",
+			len(measured), len(indices), time.Since(start), measured[len(measured)/2]*8/1000)
+	} else {
+		log.Warnf("Bandwidth probe failed for all %d proxies", len(indices))
+	}
+
+	return speeds
+}
+
+// probeBandwidth reads limit bytes of url through the proxy and returns
+// bytes/sec over the body transfer, so connection setup and time to first
+// byte do not count
+func probeBandwidth(ctx context.Context, client *http.Client, candidate types.Candidate, url string, limit int64) (int64, error) {
+	switch candidate.Scheme() {
+	case "http", "https", "socks4", "socks5":
+	default:
+		return 0, fmt.Errorf("unsupported proxy protocol %q", candidate.Protocol)
+	}
+
+	reqCtx := context.WithValue(ctx, proxyURLKey{}, candidate.URL())
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	// The transport pools SOCKS4 tunnels by target, not by proxy
+	req.Close = candidate.Scheme() == "socks4"
+	// Compressed transfer would overstate throughput
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, limit))
+	elapsed := time.Since(start)
+	if err != nil {
+		return 0, fmt.Errorf("read after %d bytes: %w", n, err)
+	}
+	if n < limit {
+		// Likely a captive portal or error page, not the payload
+		return 0, fmt.Errorf("payload ended after %d of %d bytes", n, limit)
+	}
+	if elapsed < time.Millisecond {
+		elapsed = time.Millisecond
+	}
+	return int64(float64(n) / elapsed.Seconds()), nil
+}
@@ -4,41 +4,107 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/netip"
 	"net/url"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/proxy-checker-api/internal/config"
 	"github.com/proxy-checker-api/internal/metrics"
+	"github.com/proxy-checker-api/internal/types"
 	log "github.com/sirupsen/logrus"
 )
 
 type Checker struct {
-	config    config.CheckerConfig
+	state     atomic.Pointer[checkerState]
 	metrics   *metrics.Collector
+	addrGuard atomic.Pointer[AddrGuard]
+}
+
+// AddrGuard vets an address the checker is about to connect to
+type AddrGuard func(addr netip.Addr) error
+
+// checkerState bundles everything derived from CheckerConfig so a config
+// update swaps it in one step; checks already running keep their snapshot
+type checkerState struct {
+	config    config.CheckerConfig
+	dialer    *net.Dialer
 	transport *http.Transport
 	client    *http.Client
 }
 
 type CheckResult struct {
+	Candidate types.Candidate // set by CheckProxies
 	Proxy     string
 	Alive     bool
 	LatencyMs int64
+	ExitIP    string        // address the test URL saw, with detect_exit_ip
+	Timing    *types.Timing // phases of a successful check
+	Samples   []int64       // latencies of every successful probe, with latency_samples > 1
 	Error     string
 }
 
 func NewChecker(cfg config.CheckerConfig, metricsCollector *metrics.Collector) *Checker {
+	c := &Checker{
+		metrics: metricsCollector,
+	}
+	c.state.Store(newCheckerState(cfg, c.dialControl))
+	return c
+}
+
+// SetAddrGuard makes every proxy connection subject to guard. It sees the
+// address actually dialed, so a proxy hostname vetted earlier cannot
+// resolve to a different address by the time it is checked.
+func (c *Checker) SetAddrGuard(guard AddrGuard) {
+	c.addrGuard.Store(&guard)
+}
+
+// dialControl applies the address guard once a connection's address is known
+func (c *Checker) dialControl(network, address string, _ syscall.RawConn) error {
+	guard := c.addrGuard.Load()
+	if guard == nil {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return (*guard)(addrPort.Addr())
+}
+
+// UpdateConfig applies new checker settings. Checks in flight finish with
+// the previous settings; the next check uses the new ones.
+func (c *Checker) UpdateConfig(cfg config.CheckerConfig) {
+	old := c.state.Swap(newCheckerState(cfg, c.dialControl))
+	old.transport.CloseIdleConnections()
+	log.Infof("Checker config updated: timeout=%dms, concurrency=%d, mode=%s, test_url=%s",
+		cfg.TimeoutMs, cfg.ConcurrencyTotal, cfg.Mode, cfg.TestURL)
+}
+
+// Config returns the current checker settings
+func (c *Checker) Config() config.CheckerConfig {
+	return c.state.Load().config
+}
+
+func newCheckerState(cfg config.CheckerConfig, control func(network, address string, c syscall.RawConn) error) *checkerState {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+
 	// Create highly optimized transport for mass concurrency
 	transport := &http.Transport{
-		Proxy: nil, // We set proxy per-request
-		DialContext: (&net.Dialer{
-			Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		Proxy:                 proxyFromContext, // Proxy URL travels with each request
+		DialContext:           dialContext(dialer),
 		ForceAttemptHTTP2:     false, // Disable HTTP/2 for proxy checking
 		MaxIdleConns:          cfg.ConcurrencyTotal,
 		MaxIdleConnsPerHost:   100,
@@ -60,24 +126,50 @@ func NewChecker(cfg config.CheckerConfig, metricsCollector *metrics.Collector) *
 		},
 	}
 
-	return &Checker{
+	return &checkerState{
 		config:    cfg,
-		metrics:   metricsCollector,
+		dialer:    dialer,
 		transport: transport,
 		client:    client,
 	}
 }
 
-// CheckProxies performs high-concurrency proxy validation
-func (c *Checker) CheckProxies(ctx context.Context, proxies []string) []CheckResult {
+// proxyURLKey carries the proxy for a check request. The transport is shared
+// by all concurrent checks, so the proxy cannot be set on the transport.
+type proxyURLKey struct{}
+
+func proxyURLFromContext(ctx context.Context) *url.URL {
+	proxyURL, _ := ctx.Value(proxyURLKey{}).(*url.URL)
+	return proxyURL
+}
+
+// proxyFromContext hands http(s) and SOCKS5 proxies to the transport;
+// SOCKS4 proxies are dialed by dialContext instead
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	proxyURL := proxyURLFromContext(req.Context())
+	if proxyURL != nil && proxyURL.Scheme == "socks4" {
+		return nil, nil
+	}
+	return proxyURL, nil
+}
+
+// ProgressFunc is called after each completed check with the number of
+// proxies checked so far. It runs on checker goroutines and must be cheap.
+type ProgressFunc func(checked int)
+
+// CheckProxies performs high-concurrency proxy validation. progress may be
+// nil. When ctx is cancelled no new checks are started and the results
+// gathered so far are returned.
+func (c *Checker) CheckProxies(ctx context.Context, proxies []types.Candidate, progress ProgressFunc) []CheckResult {
+	cfg := c.Config()
 	totalProxies := len(proxies)
-	log.Infof("Starting proxy check: %d proxies, concurrency=%d", totalProxies, c.config.ConcurrencyTotal)
+	log.Infof("Starting proxy check: %d proxies, concurrency=%d", totalProxies, cfg.ConcurrencyTotal)
 
 	startTime := time.Now()
 
 	// Adaptive concurrency adjustment
-	concurrency := c.config.ConcurrencyTotal
-	if c.config.EnableAdaptiveConcurrency {
+	concurrency := cfg.ConcurrencyTotal
+	if cfg.EnableAdaptiveConcurrency {
 		concurrency = c.adjustConcurrency(concurrency)
 	}
 
@@ -90,25 +182,35 @@ func (c *Checker) CheckProxies(ctx context.Context, proxies []string) []CheckRes
 	// Progress tracking
 	var completed atomic.Int64
 	progressTicker := time.NewTicker(5 * time.Second)
-	defer progressTicker.Stop()
+	progressDone := make(chan struct{})
+	defer func() {
+		progressTicker.Stop()
+		close(progressDone)
+	}()
 
 	go func() {
-		for range progressTicker.C {
-			current := completed.Load()
-			percent := float64(current) / float64(totalProxies) * 100.0
-			log.Infof("Progress: %d/%d (%.1f%%), goroutines=%d",
-				current, totalProxies, percent, runtime.NumGoroutine())
+		for {
+			select {
+			case <-progressTicker.C:
+				current := completed.Load()
+				percent := float64(current) / float64(totalProxies) * 100.0
+				log.Infof("Progress: %d/%d (%.1f%%), goroutines=%d",
+					current, totalProxies, percent, runtime.NumGoroutine())
+			case <-progressDone:
+				return
+			}
 		}
 	}()
 
 	// Process in batches
-	batchSize := c.config.BatchSize
+	batchSize := cfg.BatchSize
 	if batchSize <= 0 {
 		batchSize = 2000
 	}
 
 	var wg sync.WaitGroup
 
+batches:
 	for i := 0; i < totalProxies; i += batchSize {
 		end := i + batchSize
 		if end > totalProxies {
@@ -118,27 +220,35 @@ func (c *Checker) CheckProxies(ctx context.Context, proxies []string) []CheckRes
 		batch := proxies[i:end]
 
 		for _, proxy := range batch {
-			// Acquire semaphore
-			sem <- struct{}{}
+			// Acquire semaphore, stop scheduling once cancelled
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				break batches
+			}
 			wg.Add(1)
 
-			go func(proxyAddr string) {
+			go func(candidate types.Candidate) {
 				defer wg.Done()
 				defer func() { <-sem }() // Release semaphore
 
 				// Check with retries
-				result := c.checkProxyWithRetries(ctx, proxyAddr)
+				result := c.checkProxyWithRetries(ctx, candidate)
 
 				resultsMu.Lock()
 				results = append(results, result)
 				resultsMu.Unlock()
 
-				completed.Add(1)
+				checked := completed.Add(1)
+				if progress != nil {
+					progress(int(checked))
+				}
 
 				// Record metrics
 				if result.Alive {
 					c.metrics.RecordCheckSuccess()
 					c.metrics.RecordCheckDuration(float64(result.LatencyMs) / 1000.0)
+					c.recordTiming(result.Timing)
 				} else {
 					c.metrics.RecordCheckFailure()
 				}
@@ -155,15 +265,19 @@ func (c *Checker) CheckProxies(ctx context.Context, proxies []string) []CheckRes
 	wg.Wait()
 
 	duration := time.Since(startTime)
-	checksPerSecond := float64(totalProxies) / duration.Seconds()
+	checksPerSecond := float64(len(results)) / duration.Seconds()
+	if ctx.Err() != nil {
+		log.Warnf("Check cancelled: %d/%d proxies checked in %v", len(results), totalProxies, duration)
+		return results
+	}
 	log.Infof("Check complete: %d proxies in %v (%.0f checks/sec)",
 		totalProxies, duration, checksPerSecond)
 
 	return results
 }
 
-func (c *Checker) checkProxyWithRetries(ctx context.Context, proxyAddr string) CheckResult {
-	maxRetries := c.config.Retries
+func (c *Checker) checkProxyWithRetries(ctx context.Context, candidate types.Candidate) CheckResult {
+	maxRetries := c.Config().Retries
 	if maxRetries < 0 {
 		maxRetries = 0
 	}
@@ -177,35 +291,41 @@ func (c *Checker) checkProxyWithRetries(ctx context.Context, proxyAddr string) C
 			time.Sleep(backoff)
 		}
 
-		result := c.checkProxy(ctx, proxyAddr)
+		result := c.checkProxy(ctx, candidate)
 		if result.Alive {
-			return result
+			return c.sampleLatency(ctx, candidate, result)
 		}
 
 		lastError = result.Error
 	}
 
 	return CheckResult{
-		Proxy: proxyAddr,
-		Alive: false,
-		Error: lastError,
+		Candidate: candidate,
+		Proxy:     candidate.Address,
+		Alive:     false,
+		Error:     lastError,
 	}
 }
 
-func (c *Checker) checkProxy(ctx context.Context, proxyAddr string) CheckResult {
+func (c *Checker) checkProxy(ctx context.Context, candidate types.Candidate) CheckResult {
 	startTime := time.Now()
-
-	if c.config.Mode == "connect-only" {
-		return c.checkConnectOnly(ctx, proxyAddr, startTime)
+	state := c.state.Load()
+
+	var result CheckResult
+	if state.config.Mode == "connect-only" {
+		result = c.checkConnectOnly(ctx, state, candidate.Address, startTime)
+	} else {
+		// Full HTTP check
+		result = c.checkFullHTTP(ctx, state, candidate, startTime)
 	}
 
-	// Full HTTP check
-	return c.checkFullHTTP(ctx, proxyAddr, startTime)
+	result.Candidate = candidate
+	return result
 }
 
-func (c *Checker) checkConnectOnly(ctx context.Context, proxyAddr string, startTime time.Time) CheckResult {
-	timeout := time.Duration(c.config.TimeoutMs) * time.Millisecond
-	conn, err := net.DialTimeout("tcp", proxyAddr, timeout)
+func (c *Checker) checkConnectOnly(ctx context.Context, state *checkerState, proxyAddr string, startTime time.Time) CheckResult {
+	trace := &phaseTrace{}
+	conn, err := state.dialer.DialContext(httptrace.WithClientTrace(ctx, trace.clientTrace()), "tcp", proxyAddr)
 	if err != nil {
 		return CheckResult{
 			Proxy: proxyAddr,
@@ -220,24 +340,34 @@ func (c *Checker) checkConnectOnly(ctx context.Context, proxyAddr string, startT
 		Proxy:     proxyAddr,
 		Alive:     true,
 		LatencyMs: latency.Milliseconds(),
+		Timing:    trace.timing(),
 	}
 }
 
-func (c *Checker) checkFullHTTP(ctx context.Context, proxyAddr string, startTime time.Time) CheckResult {
-	proxyURL, err := url.Parse(fmt.Sprintf("http://%s", proxyAddr))
-	if err != nil {
+func (c *Checker) checkFullHTTP(ctx context.Context, state *checkerState, candidate types.Candidate, startTime time.Time) CheckResult {
+	proxyAddr := candidate.Address
+
+	switch candidate.Scheme() {
+	case "http", "https", "socks4", "socks5":
+	default:
 		return CheckResult{
 			Proxy: proxyAddr,
 			Alive: false,
-			Error: fmt.Sprintf("parse proxy URL: %v", err),
+			Error: fmt.Sprintf("unsupported proxy protocol %q", candidate.Protocol),
 		}
 	}
 
 	// Create request with timeout context
-	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(c.config.TimeoutMs)*time.Millisecond)
+	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(state.config.TimeoutMs)*time.Millisecond)
+	reqCtx = context.WithValue(reqCtx, proxyURLKey{}, candidate.URL())
 	defer cancel()
+	trace := &phaseTrace{
+		tunnel: candidate.Scheme() == "socks4" || candidate.Scheme() == "socks5" ||
+			strings.HasPrefix(state.config.TestURL, "https:"),
+	}
+	reqCtx = httptrace.WithClientTrace(reqCtx, trace.clientTrace())
 
-	req, err := http.NewRequestWithContext(reqCtx, "GET", c.config.TestURL, nil)
+	req, err := http.NewRequestWithContext(reqCtx, "GET", state.config.TestURL, nil)
 	if err != nil {
 		return CheckResult{
 			Proxy: proxyAddr,
@@ -246,10 +376,10 @@ func (c *Checker) checkFullHTTP(ctx context.Context, proxyAddr string, startTime
 		}
 	}
 
-	// Set proxy for this request
-	c.transport.Proxy = http.ProxyURL(proxyURL)
+	// Every probe, retry and latency sample measures a fresh connection
+	req.Close = true
 
-	resp, err := c.client.Do(req)
+	resp, err := state.client.Do(req)
 	if err != nil {
 		return CheckResult{
 			Proxy: proxyAddr,
@@ -263,11 +393,17 @@ func (c *Checker) checkFullHTTP(ctx context.Context, proxyAddr string, startTime
 
 	// Consider 2xx and 3xx as success
 	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		return CheckResult{
+		result := CheckResult{
 			Proxy:     proxyAddr,
 			Alive:     true,
 			LatencyMs: latency.Milliseconds(),
+			Timing:    trace.timing(),
 		}
+		if state.config.DetectExitIP {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxExitIPBody))
+			result.ExitIP = parseExitIP(body)
+		}
+		return result
 	}
 
 	return CheckResult{
@@ -293,8 +429,24 @@ func (c *Checker) adjustConcurrency(requested int) int {
 	return requested
 }
 
-// CheckSingle checks a single proxy (used by API for on-demand checks)
-func (c *Checker) CheckSingle(ctx context.Context, proxyAddr string) CheckResult {
-	return c.checkProxyWithRetries(ctx, proxyAddr)
+// sampleLatency probes an alive proxy until it has latency_samples
+// measurements. Failed probes are skipped; they do not make it dead.
+func (c *Checker) sampleLatency(ctx context.Context, candidate types.Candidate, result CheckResult) CheckResult {
+	samples := c.Config().LatencySamples
+	if samples <= 1 {
+		return result
+	}
+
+	result.Samples = append(make([]int64, 0, samples), result.LatencyMs)
+	for i := 1; i < samples && ctx.Err() == nil; i++ {
+		if probe := c.checkProxy(ctx, candidate); probe.Alive {
+			result.Samples = append(result.Samples, probe.LatencyMs)
+		}
+	}
+	return result
 }
 
+// CheckSingle checks a single proxy (used by API for on-demand checks)
+func (c *Checker) CheckSingle(ctx context.Context, candidate types.Candidate) CheckResult {
+	return c.checkProxyWithRetries(ctx, candidate)
+}
@@ -0,0 +1,69 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+func TestAddrGuard(t *testing.T) {
+	// Answers every request itself, so it passes for an HTTP proxy
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+	_, port, _ := net.SplitHostPort(proxy.Listener.Addr().String())
+
+	rejectLoopback := func(addr netip.Addr) error {
+		if addr.IsLoopback() {
+			return errors.New("loopback")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		guard   AddrGuard
+		mode    string
+		address string
+		alive   bool
+	}{
+		{"no guard", nil, "full-http", "127.0.0.1:" + port, true},
+		{"accepted", func(netip.Addr) error { return nil }, "full-http", "127.0.0.1:" + port, true},
+		{"rejected address", rejectLoopback, "full-http", "127.0.0.1:" + port, false},
+		// Vetting the hostname beforehand says nothing about what it
+		// resolves to when dialed
+		{"rejected hostname", rejectLoopback, "full-http", "localhost:" + port, false},
+		{"rejected connect-only", rejectLoopback, "connect-only", "127.0.0.1:" + port, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(config.CheckerConfig{
+				TimeoutMs:        5000,
+				ConcurrencyTotal: 10,
+				TestURL:          "http://example.com/",
+				Mode:             tt.mode,
+			}, nil)
+			if tt.guard != nil {
+				c.SetAddrGuard(tt.guard)
+			}
+
+			result := c.CheckSingle(context.Background(), types.Candidate{Address: tt.address, Protocol: "http"})
+			if result.Alive != tt.alive {
+				t.Fatalf("alive = %t (%s), want %t", result.Alive, result.Error, tt.alive)
+			}
+			if !tt.alive && !strings.Contains(result.Error, "loopback") {
+				t.Errorf("error %q does not name the guard's reason", result.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// maxExitIPBody bounds how much of the test URL response is read to find
+// the exit IP
+const maxExitIPBody = 64 * 1024
+
+// remoteAddrPattern matches the REMOTE_ADDR line of azenv-style judges
+var remoteAddrPattern = regexp.MustCompile(`REMOTE_ADDR\s*=\s*([0-9A-Fa-f:.]+)`)
+
+// parseExitIP finds the client address a test URL reports: a bare IP
+// (ipify, icanhazip), the "ip", "origin" or "query" field of a JSON object
+// (ipinfo, httpbin, ip-api) or the REMOTE_ADDR of a proxy judge page. It
+// returns "" when the body holds none of these.
+func parseExitIP(body []byte) string {
+	body = bytes.TrimSpace(body)
+
+	if ip := normalizeIP(string(body)); ip != "" {
+		return ip
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) == nil {
+		for _, key := range []string{"ip", "origin", "query"} {
+			value, _ := fields[key].(string)
+			// httpbin lists forwarded-for addresses first; the last one
+			// connected to it
+			if i := strings.LastIndexByte(value, ','); i >= 0 {
+				value = value[i+1:]
+			}
+			if ip := normalizeIP(value); ip != "" {
+				return ip
+			}
+		}
+		return ""
+	}
+
+	if m := remoteAddrPattern.FindSubmatch(body); m != nil {
+		return normalizeIP(string(m[1]))
+	}
+	return ""
+}
+
+func normalizeIP(s string) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	return addr.Unmap().String()
+}
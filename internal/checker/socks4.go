@@ -0,0 +1,104 @@
+package checker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// SOCKS4 reply codes
+const (
+	socks4Granted        = 0x5a
+	socks4Rejected       = 0x5b
+	socks4NoIdentd       = 0x5c
+	socks4IdentdMismatch = 0x5d
+)
+
+// dialContext dials addr directly, or through the SOCKS4 proxy of the check
+// request, which net/http cannot do itself. Other proxy schemes are handled
+// by the transport and reach here as a plain dial of the proxy.
+func dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		proxyURL := proxyURLFromContext(ctx)
+		if proxyURL == nil || proxyURL.Scheme != "socks4" {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		conn, err := dialer.DialContext(ctx, network, proxyURL.Host)
+		if err != nil {
+			return nil, err
+		}
+		if err := socks4Connect(ctx, conn, addr, proxyURL.User.Username()); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("socks4 connect to %s: %w", addr, err)
+		}
+		return conn, nil
+	}
+}
+
+// socks4Connect asks the proxy on conn to connect to addr. Hostnames are
+// left to the proxy to resolve (SOCKS4a); IPv6 targets are not possible.
+func socks4Connect(ctx context.Context, conn net.Conn, addr, userID string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	req := []byte{4, 1, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(port))
+	var hostname string
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !ip.Unmap().Is4() {
+			return errors.New("IPv6 targets are not supported")
+		}
+		ip4 := ip.Unmap().As4()
+		req = append(req, ip4[:]...)
+	} else {
+		// 0.0.0.x with x != 0 marks a SOCKS4a hostname request
+		req = append(req, 0, 0, 0, 1)
+		hostname = host
+	}
+	req = append(req, userID...)
+	req = append(req, 0)
+	if hostname != "" {
+		req = append(req, hostname...)
+		req = append(req, 0)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [8]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("read reply: %w", err)
+	}
+	if reply[0] != 0 {
+		return fmt.Errorf("invalid reply version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks4Granted:
+		return nil
+	case socks4Rejected:
+		return errors.New("request rejected or failed")
+	case socks4NoIdentd, socks4IdentdMismatch:
+		return errors.New("rejected by identd check")
+	default:
+		return fmt.Errorf("unknown reply code %#x", reply[1])
+	}
+}
@@ -0,0 +1,173 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+func TestSocks4Connect(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		userID  string
+		reply   byte
+		want    []byte
+		wantErr bool
+	}{
+		{"ipv4", "1.2.3.4:80", "", socks4Granted,
+			[]byte{4, 1, 0, 80, 1, 2, 3, 4, 0}, false},
+		{"ipv4 with user id", "1.2.3.4:8080", "bob", socks4Granted,
+			[]byte{4, 1, 0x1f, 0x90, 1, 2, 3, 4, 'b', 'o', 'b', 0}, false},
+		{"ipv4-mapped ipv6", "[::ffff:1.2.3.4]:443", "", socks4Granted,
+			[]byte{4, 1, 1, 0xbb, 1, 2, 3, 4, 0}, false},
+		{"hostname", "example.com:443", "", socks4Granted,
+			append([]byte{4, 1, 1, 0xbb, 0, 0, 0, 1, 0}, "example.com\x00"...), false},
+		{"rejected", "1.2.3.4:80", "", socks4Rejected,
+			[]byte{4, 1, 0, 80, 1, 2, 3, 4, 0}, true},
+		{"identd", "1.2.3.4:80", "", socks4NoIdentd,
+			[]byte{4, 1, 0, 80, 1, 2, 3, 4, 0}, true},
+		{"unknown reply", "1.2.3.4:80", "", 0x42,
+			[]byte{4, 1, 0, 80, 1, 2, 3, 4, 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			got := make(chan []byte, 1)
+			go func() {
+				defer server.Close()
+				buf := make([]byte, len(tt.want))
+				if _, err := io.ReadFull(server, buf); err != nil {
+					got <- nil
+					return
+				}
+				got <- buf
+				server.Write([]byte{0, tt.reply, 0, 0, 0, 0, 0, 0})
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := socks4Connect(ctx, client, tt.addr, tt.userID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("socks4Connect(%q) error = %v, want error %t", tt.addr, err, tt.wantErr)
+			}
+			if req := <-got; !bytes.Equal(req, tt.want) {
+				t.Errorf("request = %v, want %v", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestSocks4ConnectInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+	}{
+		{"ipv6", "[2001:db8::1]:80"},
+		{"no port", "1.2.3.4"},
+		{"bad port", "1.2.3.4:http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			if err := socks4Connect(context.Background(), client, tt.addr, ""); err == nil {
+				t.Errorf("socks4Connect(%q) succeeded, want error", tt.addr)
+			}
+		})
+	}
+}
+
+// serveSocks4 runs a minimal SOCKS4 proxy that relays every granted
+// connection and counts the CONNECT requests it receives
+func serveSocks4(t *testing.T, connects chan<- string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				var head [8]byte
+				if _, err := io.ReadFull(r, head[:]); err != nil {
+					return
+				}
+				if _, err := r.ReadString(0); err != nil { // user id
+					return
+				}
+				port := binary.BigEndian.Uint16(head[2:4])
+				target := net.JoinHostPort(net.IP(head[4:8]).String(), strconv.Itoa(int(port)))
+				connects <- target
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{0, socks4Rejected, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{0, socks4Granted, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, r)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestCheckThroughSocks4(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	connects := make(chan string, 4)
+	proxy := serveSocks4(t, connects)
+	defer proxy.Close()
+
+	c := NewChecker(config.CheckerConfig{
+		TimeoutMs:        5000,
+		ConcurrencyTotal: 10,
+		TestURL:          target.URL,
+		Mode:             "full-http",
+	}, nil)
+
+	candidate := types.Candidate{Address: proxy.Addr().String(), Protocol: "socks4"}
+	// Twice, so a pooled tunnel would show up as a missing CONNECT
+	for i := 0; i < 2; i++ {
+		result := c.CheckSingle(context.Background(), candidate)
+		if !result.Alive {
+			t.Fatalf("check %d through socks4 failed: %s", i, result.Error)
+		}
+		select {
+		case got := <-connects:
+			if want := target.Listener.Addr().String(); got != want {
+				t.Errorf("proxy connected to %s, want %s", got, want)
+			}
+		default:
+			t.Fatalf("check %d did not go through the proxy", i)
+		}
+	}
+}
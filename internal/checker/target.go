@@ -0,0 +1,196 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxTargetBody caps how much of a target response body patterns see
+const maxTargetBody = 1024 * 1024
+
+// targetMatch is a compiled config.TargetMatch
+type targetMatch struct {
+	status  []int
+	body    []*regexp.Regexp
+	headers map[string]*regexp.Regexp
+}
+
+func compileTargetMatch(m config.TargetMatch) (*targetMatch, error) {
+	compiled := &targetMatch{status: m.Status, headers: make(map[string]*regexp.Regexp, len(m.Headers))}
+	for _, pattern := range m.Body {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("body pattern: %w", err)
+		}
+		compiled.body = append(compiled.body, re)
+	}
+	for name, pattern := range m.Headers {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("header %s pattern: %w", name, err)
+		}
+		compiled.headers[http.CanonicalHeaderKey(name)] = re
+	}
+	return compiled, nil
+}
+
+// headerMatches reports whether any value of the header matches re; an
+// empty pattern only requires the header to be present
+func headerMatches(header http.Header, name string, re *regexp.Regexp) bool {
+	for _, value := range header.Values(name) {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedBy returns the first part of the block signature the response
+// matches
+func (m *targetMatch) blockedBy(resp *http.Response, body []byte) (string, bool) {
+	if slices.Contains(m.status, resp.StatusCode) {
+		return fmt.Sprintf("HTTP %d", resp.StatusCode), true
+	}
+	for name, re := range m.headers {
+		if headerMatches(resp.Header, name, re) {
+			return "header " + name, true
+		}
+	}
+	for _, re := range m.body {
+		if re.Match(body) {
+			return fmt.Sprintf("body matches %q", re.String()), true
+		}
+	}
+	return "", false
+}
+
+// unmet returns the first success criterion the response misses
+func (m *targetMatch) unmet(resp *http.Response, body []byte) (string, bool) {
+	if len(m.status) == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Sprintf("HTTP %d, expected 2xx", resp.StatusCode), true
+	}
+	if len(m.status) > 0 && !slices.Contains(m.status, resp.StatusCode) {
+		return fmt.Sprintf("HTTP %d, expected %v", resp.StatusCode, m.status), true
+	}
+	for name, re := range m.headers {
+		if !headerMatches(resp.Header, name, re) {
+			return "header " + name + " missing or not matching", true
+		}
+	}
+	for _, re := range m.body {
+		if !re.Match(body) {
+			return fmt.Sprintf("body does not match %q", re.String()), true
+		}
+	}
+	return "", false
+}
+
+func (m *targetMatch) needsBody() bool {
+	return len(m.body) > 0
+}
+
+// CheckTarget requests the profile URL through each candidate, running
+// profile.Concurrency requests at a time. Candidates not checked because
+// ctx was cancelled get an empty status.
+func (c *Checker) CheckTarget(ctx context.Context, profile config.TargetProfile, candidates []types.Candidate) ([]types.TargetStatus, error) {
+	success, err := compileTargetMatch(profile.Success)
+	if err != nil {
+		return nil, fmt.Errorf("success: %w", err)
+	}
+	block, err := compileTargetMatch(profile.Block)
+	if err != nil {
+		return nil, fmt.Errorf("block: %w", err)
+	}
+
+	// Redirects are not followed so a redirect to a captcha page can be
+	// matched by its status or Location header
+	client := &http.Client{
+		Transport: c.state.Load().transport,
+		Timeout:   time.Duration(profile.TimeoutMs) * time.Millisecond,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	statuses := make([]types.TargetStatus, len(candidates))
+	sem := make(chan struct{}, profile.Concurrency)
+	var wg sync.WaitGroup
+
+	for i := range candidates {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return statuses, nil
+		}
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			statuses[i] = checkTarget(ctx, client, profile, success, block, candidates[i])
+			log.Debugf("Target %s through %s: %s %s", profile.Name, candidates[i].Address,
+				statuses[i].Status, statuses[i].Reason)
+		}(i)
+	}
+	wg.Wait()
+
+	return statuses, nil
+}
+
+func checkTarget(ctx context.Context, client *http.Client, profile config.TargetProfile, success, block *targetMatch,
+	candidate types.Candidate) types.TargetStatus {
+	start := time.Now()
+	failed := func(format string, args ...any) types.TargetStatus {
+		return types.TargetStatus{Status: types.TargetFailed, Reason: fmt.Sprintf(format, args...), CheckedAt: start}
+	}
+
+	switch candidate.Scheme() {
+	case "http", "https", "socks4", "socks5":
+	default:
+		return failed("unsupported proxy protocol %q", candidate.Protocol)
+	}
+
+	reqCtx := context.WithValue(ctx, proxyURLKey{}, candidate.URL())
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, profile.URL, nil)
+	if err != nil {
+		return failed("create request: %v", err)
+	}
+	// The transport pools SOCKS4 tunnels by target, not by proxy
+	req.Close = candidate.Scheme() == "socks4"
+	for name, value := range profile.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return failed("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if success.needsBody() || block.needsBody() {
+		// A truncated body is still matched against
+		body, _ = io.ReadAll(io.LimitReader(resp.Body, maxTargetBody))
+	}
+	latency := time.Since(start).Milliseconds()
+
+	if reason, ok := block.blockedBy(resp, body); ok {
+		return types.TargetStatus{Status: types.TargetBlocked, Reason: reason, LatencyMs: latency, CheckedAt: start}
+	}
+	if reason, ok := success.unmet(resp, body); ok {
+		return types.TargetStatus{Status: types.TargetFailed, Reason: reason, LatencyMs: latency, CheckedAt: start}
+	}
+	return types.TargetStatus{Status: types.TargetOK, LatencyMs: latency, CheckedAt: start}
+}
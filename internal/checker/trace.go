@@ -0,0 +1,147 @@
+package checker
+
+import (
+	"crypto/tls"
+	"math"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/types"
+)
+
+// Check phases, as labelled in check_phase_duration_seconds
+const (
+	PhaseDNS       = "dns"
+	PhaseConnect   = "connect"
+	PhaseHandshake = "handshake"
+	PhaseTLS       = "tls"
+	PhaseTTFB      = "ttfb"
+)
+
+// phaseTrace collects the httptrace events of one check. Dialing may run
+// on another goroutine, so events are recorded under a lock.
+type phaseTrace struct {
+	tunnel bool // the proxy negotiates a tunnel (SOCKS, or CONNECT for https)
+
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tls          time.Duration // summed: an https proxy adds a second handshake
+	gotConn      time.Time
+	reused       bool
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *phaseTrace) record(fn func()) {
+	t.mu.Lock()
+	fn()
+	t.mu.Unlock()
+}
+
+func (t *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func() { t.dnsDone = time.Now() })
+		},
+		ConnectStart: func(network, addr string) {
+			t.record(func() {
+				// Keep the first of parallel (happy eyeballs) attempts
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.record(func() {
+				if err == nil && t.connectDone.IsZero() {
+					t.connectDone = time.Now()
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			t.record(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(func() {
+				if !t.tlsStart.IsZero() {
+					t.tls += time.Since(t.tlsStart)
+				}
+			})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.record(func() {
+				t.gotConn = time.Now()
+				t.reused = info.Reused
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.record(func() { t.wroteRequest = time.Now() })
+		},
+		GotFirstResponseByte: func() {
+			t.record(func() { t.firstByte = time.Now() })
+		},
+	}
+}
+
+// timing turns the recorded events into phase durations. For tunnels, the
+// proxy handshake is what remains between the TCP connect and a usable
+// connection once TLS is taken out.
+func (t *phaseTrace) timing() *types.Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timing := &types.Timing{
+		DNSMs:  between(t.dnsStart, t.dnsDone),
+		TTFBMs: between(t.wroteRequest, t.firstByte),
+	}
+	if t.reused {
+		return timing
+	}
+	timing.ConnectMs = between(t.connectStart, t.connectDone)
+	timing.TLSMs = ms(t.tls)
+	if t.tunnel && !t.connectDone.IsZero() && !t.gotConn.IsZero() {
+		timing.HandshakeMs = ms(max(t.gotConn.Sub(t.connectDone)-t.tls, 0))
+	}
+	return timing
+}
+
+func between(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return ms(end.Sub(start))
+}
+
+// ms converts to milliseconds with microsecond precision
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// recordTiming observes the phases of a successful check that happened
+func (c *Checker) recordTiming(timing *types.Timing) {
+	if timing == nil {
+		return
+	}
+	for _, phase := range []struct {
+		name string
+		ms   float64
+	}{
+		{PhaseDNS, timing.DNSMs},
+		{PhaseConnect, timing.ConnectMs},
+		{PhaseHandshake, timing.HandshakeMs},
+		{PhaseTLS, timing.TLSMs},
+		{PhaseTTFB, timing.TTFBMs},
+	} {
+		if phase.ms > 0 {
+			c.metrics.RecordCheckPhase(phase.name, phase.ms/1000)
+		}
+	}
+}
@@ -1,12 +1,24 @@
 package config
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
-	"sync"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/proxy-checker-api/internal/cron"
 )
 
+// Config is not modified once loaded, so it can be shared and read without
+// locking; Reload publishes a new Config instead
 type Config struct {
 	Aggregator AggregatorConfig `json:"aggregator"`
 	Checker    CheckerConfig    `json:"checker"`
@@ -14,48 +26,295 @@ type Config struct {
 	Storage    StorageConfig    `json:"storage"`
 	Metrics    MetricsConfig    `json:"metrics"`
 	Logging    LoggingConfig    `json:"logging"`
+	HotReload  HotReloadConfig  `json:"hot_reload"`
+	GeoIP      GeoIPConfig      `json:"geoip"`
 
-	mu       sync.RWMutex
 	filePath string
 }
 
 type AggregatorConfig struct {
-	IntervalSeconds int      `json:"interval_seconds"`
-	Sources         []Source `json:"sources"`
-	UserAgent       string   `json:"user_agent"`
+	IntervalSeconds int          `json:"interval_seconds"`
+	Sources         []Source     `json:"sources"`
+	UserAgent       string       `json:"user_agent"`
+	Ingest          IngestConfig `json:"ingest"`
+	Filter          FilterConfig `json:"filter"`
+
+	// Decompression bounds compressed and archived source payloads
+	Decompression DecompressionConfig `json:"decompression"`
+
+	// CacheMaxStalenessSeconds bounds how old a cached source result may be
+	// when it stands in for a failed fetch; -1 disables the fallback
+	CacheMaxStalenessSeconds int `json:"cache_max_staleness_seconds"`
+
+	// Failing sources are retried with exponential backoff capped at
+	// MaxBackoffSeconds and disabled after DisableAfterFailures consecutive
+	// failures (-1 never disables)
+	MaxBackoffSeconds    int `json:"max_backoff_seconds"`
+	DisableAfterFailures int `json:"disable_after_failures"`
+}
+
+// IngestConfig limits the POST /ingest push API
+type IngestConfig struct {
+	MaxBodyBytes     int64 `json:"max_body_bytes"`    // after decompression
+	MaxCandidates    int   `json:"max_candidates"`    // per request
+	MaxPerSource     int   `json:"max_per_source"`    // candidates retained per virtual source
+	MaxSources       int   `json:"max_sources"`       // virtual sources holding candidates at once
+	RetentionMinutes int   `json:"retention_minutes"` // how long a pushed candidate is re-checked
+}
+
+// DecompressionConfig guards against decompression bombs in gzip, zstd, zip
+// and tar payloads
+type DecompressionConfig struct {
+	MaxBytes   int64 `json:"max_bytes"`   // decompressed bytes per response or file
+	MaxEntries int   `json:"max_entries"` // archive entries per response or file
+}
+
+// FilterConfig drops candidates by address and port before they are
+// checked. Bogon (private, loopback, multicast, reserved) addresses are
+// dropped unless AllowBogons is set.
+type FilterConfig struct {
+	AllowBogons bool     `json:"allow_bogons"`
+	AllowCIDRs  []string `json:"allow_cidrs"` // when set, only addresses inside these ranges are kept
+	DenyCIDRs   []string `json:"deny_cidrs"`
+	AllowPorts  []string `json:"allow_ports"` // "8080" or "8000-8999"; when set, only these ports are kept
+	DenyPorts   []string `json:"deny_ports"`
 }
 
 type Source struct {
+	Name    string `json:"name"` // unique identifier, derived from the URL when empty
 	URL     string `json:"url"`
-	Type    string `json:"type"`
+	Type    string `json:"type"` // "txt", "json", "csv", "tsv" or "html"
 	Enabled bool   `json:"enabled"`
+
+	// Watch triggers a cycle when a file:// source's files change
+	Watch bool `json:"watch,omitempty"`
+
+	// Fetch cadence: every IntervalSeconds, or on a cron Schedule
+	// ("*/5 * * * *", "@daily"). With neither, the source is fetched with
+	// every check cycle.
+	IntervalSeconds int    `json:"interval_seconds,omitempty"`
+	Schedule        string `json:"schedule,omitempty"`
+
+	Request    *RequestOptions `json:"request,omitempty"`    // local sources only honor max_body_bytes
+	Pagination *Pagination     `json:"pagination,omitempty"` // HTTP sources only
+
+	JSON *JSONFormat  `json:"json,omitempty"`
+	CSV  *TableFormat `json:"csv,omitempty"`  // also used for "tsv"
+	HTML *TableFormat `json:"html,omitempty"` // table_index selects the table
+}
+
+// FieldMapping says where each proxy attribute is found in a record. For
+// JSON sources values are selectors relative to the record ("ip",
+// "geo.country", "ports[0]"); for CSV/HTML they are column header names or
+// zero-based column indexes ("0", "1"). Address holds a combined "ip:port"
+// value and is used when IP/Port are not mapped. Username and Password
+// override credentials embedded in Address.
+type FieldMapping struct {
+	IP       string `json:"ip,omitempty"`
+	Port     string `json:"port,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// JSONFormat describes a JSON API response
+type JSONFormat struct {
+	// Records selects the array of proxy records, e.g. "data.proxies" or
+	// "$.result[*]". Empty means the document itself is the array.
+	Records string       `json:"records"`
+	Fields  FieldMapping `json:"fields"`
+}
+
+// TableFormat describes CSV/TSV files and HTML tables
+type TableFormat struct {
+	Delimiter  string       `json:"delimiter,omitempty"` // CSV only; defaults to "," (tab for "tsv")
+	NoHeader   bool         `json:"no_header,omitempty"` // first row is data; columns must be indexes
+	TableIndex int          `json:"table_index,omitempty"`
+	Columns    FieldMapping `json:"columns"`
+}
+
+// RequestOptions customizes how an HTTP source is fetched. Secrets are
+// referenced by environment variable name so they stay out of config.json
+// and the admin API.
+type RequestOptions struct {
+	Method         string            `json:"method,omitempty"` // defaults to GET
+	Body           string            `json:"body,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	HeadersEnv     map[string]string `json:"headers_env,omitempty"` // header name -> env var holding its value
+	Auth           *SourceAuth       `json:"auth,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // defaults to 30
+	MaxBodyBytes   int64             `json:"max_body_bytes,omitempty"`  // defaults to 10MB
+	Proxy          string            `json:"proxy,omitempty"`           // http://, https:// or socks5:// upstream proxy
+}
+
+// Pagination crawls several pages of an HTTP source into one result. The
+// crawl stops at MaxPages, at a page without new proxies, or when there is
+// no next page.
+type Pagination struct {
+	Type        string `json:"type"`                   // "page", "cursor" or "link"
+	Param       string `json:"param,omitempty"`        // query parameter for the page number or cursor; defaults to "page" / "cursor"
+	Start       *int   `json:"start,omitempty"`        // first page number for "page"; defaults to 1
+	CursorField string `json:"cursor_field,omitempty"` // JSON selector of the next cursor or next-page URL for "cursor"
+	MaxPages    int    `json:"max_pages,omitempty"`    // defaults to 10, at most 1000
+	DelayMs     int    `json:"delay_ms,omitempty"`     // pause between page requests
+}
+
+// SourceAuth holds basic or bearer credentials for a source
+type SourceAuth struct {
+	Type        string `json:"type"` // "basic" or "bearer"
+	Username    string `json:"username,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+	TokenEnv    string `json:"token_env,omitempty"`
 }
 
 type CheckerConfig struct {
-	TimeoutMs                 int    `json:"timeout_ms"`
-	ConcurrencyTotal          int    `json:"concurrency_total"`
-	BatchSize                 int    `json:"batch_size"`
-	Retries                   int    `json:"retries"`
-	TestURL                   string `json:"test_url"`
-	Mode                      string `json:"mode"` // "connect-only" or "full-http"
-	EnableAdaptiveConcurrency bool   `json:"enable_adaptive_concurrency"`
-	MaxFDUsagePercent         int    `json:"max_fd_usage_percent"`
-	MaxCPUUsagePercent        int    `json:"max_cpu_usage_percent"`
+	TimeoutMs        int    `json:"timeout_ms"`
+	ConcurrencyTotal int    `json:"concurrency_total"`
+	BatchSize        int    `json:"batch_size"`
+	Retries          int    `json:"retries"`
+	TestURL          string `json:"test_url"`
+	Mode             string `json:"mode"`           // "connect-only" or "full-http"
+	DetectExitIP     bool   `json:"detect_exit_ip"` // read the exit IP from the test_url response; full-http only
+
+	// LatencySamples is the number of latency probes per alive proxy and
+	// cycle; LatencyWindow how many of the most recent ones, across
+	// cycles, latency statistics are computed from
+	LatencySamples            int  `json:"latency_samples"`
+	LatencyWindow             int  `json:"latency_window"`
+	EnableAdaptiveConcurrency bool `json:"enable_adaptive_concurrency"`
+	MaxFDUsagePercent         int  `json:"max_fd_usage_percent"`
+	MaxCPUUsagePercent        int  `json:"max_cpu_usage_percent"`
+
+	Bandwidth BandwidthConfig `json:"bandwidth"`
+	Targets   []TargetProfile `json:"targets"`
+}
+
+// BandwidthConfig sets up the optional throughput probe that downloads a
+// payload through alive proxies after each check
+type BandwidthConfig struct {
+	Enabled     bool   `json:"enabled"`
+	URL         string `json:"url"`         // payload to download, e.g. this service's /speedtest
+	Bytes       int64  `json:"bytes"`       // bytes read per probe; defaults to 1MB
+	SampleSize  int    `json:"sample_size"` // proxies probed per cycle; 0 probes every alive proxy
+	TimeoutMs   int    `json:"timeout_ms"`  // per probe; defaults to 30000
+	Concurrency int    `json:"concurrency"` // parallel probes; defaults to 20
+}
+
+// TargetProfile checks alive proxies against a site they are meant for.
+// A response matching Block is blocked; otherwise it must match Success.
+type TargetProfile struct {
+	Name            string            `json:"name"` // used in /get-proxy?works_for=
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	IntervalSeconds int               `json:"interval_seconds"` // defaults to 600
+	TimeoutMs       int               `json:"timeout_ms"`       // defaults to checker.timeout_ms
+	Concurrency     int               `json:"concurrency"`      // defaults to 50
+	Success         TargetMatch       `json:"success"`          // empty status means any 2xx
+	Block           TargetMatch       `json:"block"`
+}
+
+// TargetMatch describes responses. As a success criterion every given
+// part must match; as a block signature any one of them.
+type TargetMatch struct {
+	Status  []int             `json:"status,omitempty"`
+	Body    []string          `json:"body,omitempty"`    // regular expressions
+	Headers map[string]string `json:"headers,omitempty"` // header name -> regular expression, "" for any value
 }
 
 type APIConfig struct {
 	Addr               string `json:"addr"`
 	APIKeyEnv          string `json:"api_key_env"`
+	KeysFile           string `json:"keys_file"` // empty: keys are kept in the storage backend
 	RateLimitPerMinute int    `json:"rate_limit_per_minute"`
 	RateLimitPerIP     int    `json:"rate_limit_per_ip"`
 	EnableAPIKeyAuth   bool   `json:"enable_api_key_auth"`
 	EnableIPRateLimit  bool   `json:"enable_ip_rate_limit"`
+	RateLimitBackend   string `json:"rate_limit_backend"`    // "memory" or "redis"
+	RateLimitRedisAddr string `json:"rate_limit_redis_addr"` // defaults to storage.path when storage is redis
+}
+
+func (b BandwidthConfig) validate() error {
+	if b.Enabled {
+		u, err := url.Parse(b.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL")
+		}
+	}
+	if b.Bytes < 1024 || b.Bytes > 100*1024*1024 {
+		return fmt.Errorf("bytes must be between 1024 and 104857600")
+	}
+	if b.SampleSize < 0 {
+		return fmt.Errorf("sample_size must not be negative")
+	}
+	if b.TimeoutMs < 1000 || b.TimeoutMs > 300000 {
+		return fmt.Errorf("timeout_ms must be between 1000 and 300000")
+	}
+	if b.Concurrency < 1 || b.Concurrency > 1000 {
+		return fmt.Errorf("concurrency must be between 1 and 1000")
+	}
+	return nil
+}
+
+func (t TargetProfile) validate() error {
+	if t.Name == "" || strings.ContainsAny(t.Name, ", ") {
+		return fmt.Errorf("name must be non-empty and contain no commas or spaces")
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if t.IntervalSeconds < 10 {
+		return fmt.Errorf("interval_seconds must be at least 10")
+	}
+	if t.TimeoutMs < 100 || t.TimeoutMs > 300000 {
+		return fmt.Errorf("timeout_ms must be between 100 and 300000")
+	}
+	if t.Concurrency < 1 || t.Concurrency > 10000 {
+		return fmt.Errorf("concurrency must be between 1 and 10000")
+	}
+	if err := t.Success.validate(); err != nil {
+		return fmt.Errorf("success: %w", err)
+	}
+	if err := t.Block.validate(); err != nil {
+		return fmt.Errorf("block: %w", err)
+	}
+	return nil
+}
+
+func (m TargetMatch) validate() error {
+	for _, code := range m.Status {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid status %d", code)
+		}
+	}
+	for _, pattern := range m.Body {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("body pattern: %w", err)
+		}
+	}
+	for name, pattern := range m.Headers {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("header %s pattern: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// GeoIPConfig lists MaxMind-format (MMDB) databases used to enrich alive
+// proxies: City or Country databases for location, ASN databases for the
+// network. Files are reloaded when they change.
+type GeoIPConfig struct {
+	Databases    []string `json:"databases"`
+	LookupExitIP bool     `json:"lookup_exit_ip"` // locate proxies by their detected exit IP when known
 }
 
 type StorageConfig struct {
 	Type                   string `json:"type"` // "file", "sqlite", "redis"
 	Path                   string `json:"path"`
 	PersistIntervalSeconds int    `json:"persist_interval_seconds"`
+	CredentialsKeyEnv      string `json:"credentials_key_env"` // env var holding the key that encrypts stored proxy credentials
 }
 
 type MetricsConfig struct {
@@ -69,13 +328,27 @@ type LoggingConfig struct {
 	Format string `json:"format"`
 }
 
-var (
-	globalConfig *Config
-	configMu     sync.RWMutex
-)
+// HotReloadConfig controls live configuration reloads. SIGHUP always reloads.
+type HotReloadConfig struct {
+	WatchFile bool `json:"watch_file"` // reload automatically when config.json changes
+}
+
+// current is the most recently loaded configuration
+var current atomic.Pointer[Config]
 
 // Load reads configuration from JSON file
 func Load(filePath string) (*Config, error) {
+	cfg, err := load(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	current.Store(cfg)
+
+	return cfg, nil
+}
+
+func load(filePath string) (*Config, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("read config file: %w", err)
@@ -92,6 +365,44 @@ func Load(filePath string) (*Config, error) {
 	if cfg.Aggregator.IntervalSeconds == 0 {
 		cfg.Aggregator.IntervalSeconds = 60
 	}
+	for i := range cfg.Aggregator.Sources {
+		if cfg.Aggregator.Sources[i].Name == "" {
+			cfg.Aggregator.Sources[i].Name = DefaultSourceName(cfg.Aggregator.Sources[i].URL)
+		}
+		if cfg.Aggregator.Sources[i].Type == "" {
+			cfg.Aggregator.Sources[i].Type = "txt"
+		}
+	}
+	if cfg.Aggregator.CacheMaxStalenessSeconds == 0 {
+		cfg.Aggregator.CacheMaxStalenessSeconds = 3600
+	}
+	if cfg.Aggregator.MaxBackoffSeconds == 0 {
+		cfg.Aggregator.MaxBackoffSeconds = 3600
+	}
+	if cfg.Aggregator.DisableAfterFailures == 0 {
+		cfg.Aggregator.DisableAfterFailures = 48
+	}
+	if cfg.Aggregator.Decompression.MaxBytes == 0 {
+		cfg.Aggregator.Decompression.MaxBytes = 100 * 1024 * 1024
+	}
+	if cfg.Aggregator.Decompression.MaxEntries == 0 {
+		cfg.Aggregator.Decompression.MaxEntries = 1000
+	}
+	if cfg.Aggregator.Ingest.MaxBodyBytes == 0 {
+		cfg.Aggregator.Ingest.MaxBodyBytes = 10 * 1024 * 1024
+	}
+	if cfg.Aggregator.Ingest.MaxCandidates == 0 {
+		cfg.Aggregator.Ingest.MaxCandidates = 100000
+	}
+	if cfg.Aggregator.Ingest.MaxPerSource == 0 {
+		cfg.Aggregator.Ingest.MaxPerSource = 500000
+	}
+	if cfg.Aggregator.Ingest.MaxSources == 0 {
+		cfg.Aggregator.Ingest.MaxSources = 100
+	}
+	if cfg.Aggregator.Ingest.RetentionMinutes == 0 {
+		cfg.Aggregator.Ingest.RetentionMinutes = 1440
+	}
 	if cfg.Checker.TimeoutMs == 0 {
 		cfg.Checker.TimeoutMs = 15000
 	}
@@ -104,6 +415,33 @@ func Load(filePath string) (*Config, error) {
 	if cfg.Checker.Mode == "" {
 		cfg.Checker.Mode = "full-http"
 	}
+	if cfg.Checker.LatencySamples == 0 {
+		cfg.Checker.LatencySamples = 1
+	}
+	if cfg.Checker.LatencyWindow == 0 {
+		cfg.Checker.LatencyWindow = cfg.Checker.LatencySamples
+	}
+	if cfg.Checker.Bandwidth.Bytes == 0 {
+		cfg.Checker.Bandwidth.Bytes = 1024 * 1024
+	}
+	if cfg.Checker.Bandwidth.TimeoutMs == 0 {
+		cfg.Checker.Bandwidth.TimeoutMs = 30000
+	}
+	if cfg.Checker.Bandwidth.Concurrency == 0 {
+		cfg.Checker.Bandwidth.Concurrency = 20
+	}
+	for i := range cfg.Checker.Targets {
+		target := &cfg.Checker.Targets[i]
+		if target.IntervalSeconds == 0 {
+			target.IntervalSeconds = 600
+		}
+		if target.TimeoutMs == 0 {
+			target.TimeoutMs = cfg.Checker.TimeoutMs
+		}
+		if target.Concurrency == 0 {
+			target.Concurrency = 50
+		}
+	}
 	if cfg.Checker.TestURL == "" {
 		cfg.Checker.TestURL = "https://www.google.com/generate_204"
 	}
@@ -113,12 +451,18 @@ func Load(filePath string) (*Config, error) {
 	if cfg.API.RateLimitPerMinute == 0 {
 		cfg.API.RateLimitPerMinute = 1200
 	}
+	if cfg.API.RateLimitBackend == "" {
+		cfg.API.RateLimitBackend = "memory"
+	}
 	if cfg.Storage.Type == "" {
 		cfg.Storage.Type = "file"
 	}
 	if cfg.Storage.Path == "" {
 		cfg.Storage.Path = "/data/proxies.json"
 	}
+	if cfg.API.RateLimitRedisAddr == "" && cfg.Storage.Type == "redis" {
+		cfg.API.RateLimitRedisAddr = cfg.Storage.Path
+	}
 	if cfg.Storage.PersistIntervalSeconds == 0 {
 		cfg.Storage.PersistIntervalSeconds = 300
 	}
@@ -134,25 +478,50 @@ func Load(filePath string) (*Config, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	configMu.Lock()
-	globalConfig = &cfg
-	configMu.Unlock()
-
 	return &cfg, nil
 }
 
-// Reload reloads configuration from file
-func (c *Config) Reload() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	newCfg, err := Load(c.filePath)
+// Reload re-reads and validates the file c was loaded from and publishes
+// the result as the global config. c itself is left as it is, so the
+// caller can compare it with the returned config; an invalid file
+// publishes nothing.
+func (c *Config) Reload() (*Config, error) {
+	cfg, err := load(c.filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	*c = *newCfg
-	return nil
+	current.Store(cfg)
+	return cfg, nil
+}
+
+// FilePath returns the file the configuration was loaded from
+func (c *Config) FilePath() string {
+	return c.filePath
+}
+
+// RestartRequired lists the settings that differ between the config the
+// process started with and new but are only read at startup
+func RestartRequired(old, new *Config) []string {
+	var fields []string
+	add := func(changed bool, name string) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+
+	add(old.API.Addr != new.API.Addr, "api.addr")
+	add(old.API.APIKeyEnv != new.API.APIKeyEnv, "api.api_key_env")
+	add(old.API.KeysFile != new.API.KeysFile, "api.keys_file")
+	add(old.API.EnableAPIKeyAuth != new.API.EnableAPIKeyAuth, "api.enable_api_key_auth")
+	add(old.API.RateLimitBackend != new.API.RateLimitBackend, "api.rate_limit_backend")
+	add(old.API.RateLimitRedisAddr != new.API.RateLimitRedisAddr, "api.rate_limit_redis_addr")
+	add(old.Storage != new.Storage, "storage")
+	add(old.Metrics != new.Metrics, "metrics")
+	add(old.Logging.Format != new.Logging.Format, "logging.format")
+	add(old.HotReload != new.HotReload, "hot_reload")
+
+	return fields
 }
 
 // Validate checks configuration validity
@@ -163,19 +532,243 @@ func (c *Config) Validate() error {
 	if c.Checker.TimeoutMs < 100 || c.Checker.TimeoutMs > 300000 {
 		return fmt.Errorf("timeout_ms must be between 100 and 300000")
 	}
+	seen := make(map[string]bool, len(c.Aggregator.Sources))
+	for _, source := range c.Aggregator.Sources {
+		if seen[source.Name] {
+			return fmt.Errorf("duplicate source name %q", source.Name)
+		}
+		seen[source.Name] = true
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("source %q: %w", source.Name, err)
+		}
+	}
+	if err := c.Aggregator.Filter.validate(); err != nil {
+		return fmt.Errorf("filter: %w", err)
+	}
+	if c.Aggregator.Decompression.MaxBytes < 0 || c.Aggregator.Decompression.MaxEntries < 0 {
+		return fmt.Errorf("decompression limits must not be negative")
+	}
 	if c.Checker.Mode != "connect-only" && c.Checker.Mode != "full-http" {
 		return fmt.Errorf("mode must be 'connect-only' or 'full-http'")
 	}
+	if c.Checker.DetectExitIP && c.Checker.Mode != "full-http" {
+		return fmt.Errorf("detect_exit_ip requires mode 'full-http'")
+	}
+	if c.Checker.LatencySamples < 1 || c.Checker.LatencySamples > 20 {
+		return fmt.Errorf("latency_samples must be between 1 and 20")
+	}
+	if c.Checker.LatencyWindow < c.Checker.LatencySamples || c.Checker.LatencyWindow > 1000 {
+		return fmt.Errorf("latency_window must be between latency_samples and 1000")
+	}
+	if err := c.Checker.Bandwidth.validate(); err != nil {
+		return fmt.Errorf("bandwidth: %w", err)
+	}
+	targets := make(map[string]bool, len(c.Checker.Targets))
+	for _, target := range c.Checker.Targets {
+		if targets[target.Name] {
+			return fmt.Errorf("duplicate target name %q", target.Name)
+		}
+		targets[target.Name] = true
+		if err := target.validate(); err != nil {
+			return fmt.Errorf("target %q: %w", target.Name, err)
+		}
+	}
+	if c.API.RateLimitBackend != "memory" && c.API.RateLimitBackend != "redis" {
+		return fmt.Errorf("rate_limit_backend must be 'memory' or 'redis'")
+	}
+	if c.API.RateLimitBackend == "redis" && c.API.RateLimitRedisAddr == "" {
+		return fmt.Errorf("rate_limit_redis_addr is required for the redis rate limit backend")
+	}
 	if c.Storage.Type != "file" && c.Storage.Type != "sqlite" && c.Storage.Type != "redis" {
 		return fmt.Errorf("storage type must be 'file', 'sqlite', or 'redis'")
 	}
 	return nil
 }
 
-// GetGlobal returns global config instance
-func GetGlobal() *Config {
-	configMu.RLock()
-	defer configMu.RUnlock()
-	return globalConfig
+// Validate checks the source's format and request settings
+func (s Source) Validate() error {
+	if err := s.ValidateFormat(); err != nil {
+		return err
+	}
+	if s.IntervalSeconds < 0 {
+		return fmt.Errorf("interval_seconds must not be negative")
+	}
+	if s.Schedule != "" {
+		if s.IntervalSeconds > 0 {
+			return fmt.Errorf("interval_seconds and schedule are mutually exclusive")
+		}
+		if _, err := cron.Parse(s.Schedule); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+	}
+	if s.Request != nil {
+		if err := s.Request.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Pagination != nil {
+		return s.Pagination.validate()
+	}
+	return nil
+}
+
+func (p *Pagination) validate() error {
+	switch p.Type {
+	case "page", "link":
+	case "cursor":
+		if p.CursorField == "" {
+			return fmt.Errorf("cursor pagination requires cursor_field")
+		}
+	default:
+		return fmt.Errorf("pagination type must be 'page', 'cursor' or 'link'")
+	}
+	if p.MaxPages < 0 || p.MaxPages > 1000 {
+		return fmt.Errorf("max_pages must be between 0 and 1000")
+	}
+	if p.DelayMs < 0 || p.DelayMs > 60000 {
+		return fmt.Errorf("delay_ms must be between 0 and 60000")
+	}
+	return nil
+}
+
+func (r *RequestOptions) validate() error {
+	switch strings.ToUpper(r.Method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("unsupported request method %q", r.Method)
+	}
+	if r.TimeoutSeconds < 0 || r.TimeoutSeconds > 300 {
+		return fmt.Errorf("timeout_seconds must be between 0 and 300")
+	}
+	if r.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes must not be negative")
+	}
+	if r.Proxy != "" {
+		u, err := url.Parse(r.Proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("invalid request proxy %q", r.Proxy)
+		}
+	}
+	if r.Auth != nil {
+		switch r.Auth.Type {
+		case "basic":
+			if r.Auth.Username == "" {
+				return fmt.Errorf("basic auth requires a username")
+			}
+		case "bearer":
+			if r.Auth.TokenEnv == "" {
+				return fmt.Errorf("bearer auth requires token_env")
+			}
+		default:
+			return fmt.Errorf("auth type must be 'basic' or 'bearer'")
+		}
+	}
+	return nil
+}
+
+func (f FilterConfig) validate() error {
+	for _, cidrs := range [][]string{f.AllowCIDRs, f.DenyCIDRs} {
+		for _, cidr := range cidrs {
+			if _, err := ParseCIDR(cidr); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ports := range [][]string{f.AllowPorts, f.DenyPorts} {
+		for _, spec := range ports {
+			if _, _, err := ParsePortRange(spec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ParseCIDR parses a CIDR range; a bare address is a single-host range
+func ParseCIDR(cidr string) (netip.Prefix, error) {
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", cidr)
+	}
+	if prefix.Addr().Is4In6() {
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// ParsePortRange parses "8080" or "8000-8999"
+func ParsePortRange(spec string) (lo, hi int, err error) {
+	from, to, isRange := strings.Cut(spec, "-")
+	if lo, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || lo < 1 || lo > 65535 {
+		return 0, 0, fmt.Errorf("invalid port range %q", spec)
+	}
+	hi = lo
+	if isRange {
+		if hi, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || hi < lo || hi > 65535 {
+			return 0, 0, fmt.Errorf("invalid port range %q", spec)
+		}
+	}
+	return lo, hi, nil
+}
+
+// ValidateFormat checks that the source type is known and that structured
+// types carry the mapping they need
+func (s Source) ValidateFormat() error {
+	switch s.Type {
+	case "", "txt":
+		return nil
+	case "json":
+		if s.JSON == nil {
+			return fmt.Errorf("type json requires a \"json\" section")
+		}
+		return s.JSON.Fields.validate()
+	case "csv", "tsv":
+		if s.CSV == nil {
+			return fmt.Errorf("type %s requires a \"csv\" section", s.Type)
+		}
+		return s.CSV.Columns.validate()
+	case "html":
+		if s.HTML == nil {
+			return fmt.Errorf("type html requires an \"html\" section")
+		}
+		return s.HTML.Columns.validate()
+	default:
+		return fmt.Errorf("unknown source type %q", s.Type)
+	}
 }
 
+func (m FieldMapping) validate() error {
+	if m.Address == "" && (m.IP == "" || m.Port == "") {
+		return fmt.Errorf("field mapping needs either address or both ip and port")
+	}
+	return nil
+}
+
+// DefaultSourceName derives a stable, URL-safe name for a source from its URL
+func DefaultSourceName(rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	suffix := hex.EncodeToString(sum[:])[:8]
+
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		return u.Hostname() + "-" + suffix
+	} else if err == nil && u.Scheme != "" {
+		return u.Scheme + "-" + suffix
+	}
+	return "source-" + suffix
+}
+
+// GetGlobal returns the most recently loaded or reloaded config
+func GetGlobal() *Config {
+	return current.Load()
+}
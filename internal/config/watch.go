@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Watch calls onChange after the file at path has been written. The parent
+// directory is watched so editors and config management tools that replace
+// the file atomically (write + rename) are picked up too. Bursts of events
+// are debounced into a single call.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("resolve path: %w", err)
+	}
+
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch directory: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		const debounce = 500 * time.Millisecond
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != absPath {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					timer.Reset(debounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("Config watcher error: %v", err)
+			case <-timer.C:
+				onChange()
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"empty", ""},
+		{"too few fields", "* * * *"},
+		{"too many fields", "* * * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "0 24 * * *"},
+		{"day of month zero", "0 0 0 * *"},
+		{"month out of range", "0 0 1 13 *"},
+		{"day of week out of range", "0 0 * * 8"},
+		{"reversed range", "0 10-5 * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"negative step", "*/-1 * * * *"},
+		{"non-numeric value", "a * * * *"},
+		{"unknown descriptor", "@fortnightly"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.spec); err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", tt.spec)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, time.January, 10, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", from, time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC)},
+		{"strictly after", "8 * * * *", time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC),
+			time.Date(2024, 1, 10, 11, 8, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", from, time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC)},
+		{"step from value", "5/20 * * * *", from, time.Date(2024, 1, 10, 10, 25, 0, 0, time.UTC)},
+		{"list", "0,30 * * * *", from, time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)},
+		{"range with step", "0 6-22/4 * * *", from, time.Date(2024, 1, 10, 14, 0, 0, 0, time.UTC)},
+		{"next hour", "0 * * * *", from, time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"next day", "0 9 * * *", from, time.Date(2024, 1, 11, 9, 0, 0, 0, time.UTC)},
+		{"weekdays", "0 9 * * 1-5", time.Date(2024, 1, 12, 10, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", from, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"sunday as 0", "0 0 * * 0", from, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"day of month", "0 0 1 * *", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"month", "0 0 1 6 *", from, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches (the 15th or a Friday)
+		{"day of month or week", "0 0 15 * 5", from, time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"question mark", "0 0 ? * 5", from, time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"hourly", "@hourly", from, time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"daily", "@daily", from, time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"weekly", "@weekly", from, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"monthly", "@monthly", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"yearly", "@yearly", from, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	// UTC+5:30, so hours must advance on wall-clock fields
+	loc := time.FixedZone("IST", 5*3600+1800)
+	schedule, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2024, 1, 10, 10, 7, 0, 0, loc)
+	want := time.Date(2024, 1, 10, 11, 0, 0, 0, loc)
+	if got := schedule.Next(from); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package cycle
+
+import (
+	"math"
+	"sort"
+
+	"github.com/proxy-checker-api/internal/checker"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+// recordLatency adds the samples of this cycle's alive proxies to their
+// history, keeps the most recent window of them and returns the statistics
+// per proxy key. Proxies that are not alive any more lose their history.
+func (r *Runner) recordLatency(results []checker.CheckResult, window int) map[string]*types.Latency {
+	r.latencyMu.Lock()
+	defer r.latencyMu.Unlock()
+
+	history := make(map[string][]int64, len(results))
+	stats := make(map[string]*types.Latency, len(results))
+	for _, result := range results {
+		if !result.Alive {
+			continue
+		}
+		samples := result.Samples
+		if len(samples) == 0 {
+			samples = []int64{result.LatencyMs}
+		}
+
+		key := result.Candidate.Key()
+		merged := append(r.latencyHistory[key], samples...)
+		if len(merged) > window {
+			merged = merged[len(merged)-window:]
+		}
+		history[key] = merged
+		stats[key] = latencyStats(merged)
+	}
+	r.latencyHistory = history
+	return stats
+}
+
+// latencyStats computes nearest-rank percentiles over samples, and jitter
+// as the mean absolute difference between consecutive samples
+func latencyStats(samples []int64) *types.Latency {
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+
+	var jitter float64
+	for i := 1; i < len(samples); i++ {
+		jitter += math.Abs(float64(samples[i] - samples[i-1]))
+	}
+	if len(samples) > 1 {
+		jitter /= float64(len(samples) - 1)
+	}
+
+	return &types.Latency{
+		Samples:  len(sorted),
+		P50Ms:    percentile(sorted, 0.5),
+		P90Ms:    percentile(sorted, 0.9),
+		MaxMs:    sorted[len(sorted)-1],
+		JitterMs: math.Round(jitter*10) / 10,
+	}
+}
+
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,76 @@
+package cycle
+
+import (
+	"testing"
+
+	"github.com/proxy-checker-api/internal/checker"
+	"github.com/proxy-checker-api/internal/types"
+)
+
+func TestLatencyStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int64
+		want    types.Latency
+	}{
+		{"single sample", []int64{120}, types.Latency{Samples: 1, P50Ms: 120, P90Ms: 120, MaxMs: 120}},
+		{"two samples", []int64{100, 300}, types.Latency{Samples: 2, P50Ms: 100, P90Ms: 300, MaxMs: 300, JitterMs: 200}},
+		// Nearest rank: p50 of 4 is the 2nd, p90 the 4th
+		{"even count", []int64{40, 10, 30, 20}, types.Latency{Samples: 4, P50Ms: 20, P90Ms: 40, MaxMs: 40, JitterMs: 20}},
+		{"ten samples", []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			types.Latency{Samples: 10, P50Ms: 5, P90Ms: 9, MaxMs: 10, JitterMs: 1}},
+		{"eleven samples", []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+			types.Latency{Samples: 11, P50Ms: 6, P90Ms: 10, MaxMs: 11, JitterMs: 1}},
+		{"outlier", []int64{50, 50, 50, 50, 50, 50, 50, 50, 50, 900},
+			types.Latency{Samples: 10, P50Ms: 50, P90Ms: 50, MaxMs: 900, JitterMs: 94.4}},
+		// Jitter follows the order the samples were taken in
+		{"steady", []int64{100, 100, 100}, types.Latency{Samples: 3, P50Ms: 100, P90Ms: 100, MaxMs: 100}},
+		{"alternating", []int64{100, 200, 100}, types.Latency{Samples: 3, P50Ms: 100, P90Ms: 200, MaxMs: 200, JitterMs: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latencyStats(tt.samples); *got != tt.want {
+				t.Errorf("latencyStats(%v) = %+v, want %+v", tt.samples, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordLatencyWindow(t *testing.T) {
+	r := &Runner{}
+	candidate := types.Candidate{Address: "1.2.3.4:80"}
+	key := candidate.Key()
+	alive := func(latency int64, samples ...int64) checker.CheckResult {
+		return checker.CheckResult{
+			Candidate: candidate,
+			Alive:     true,
+			LatencyMs: latency,
+			Samples:   samples,
+		}
+	}
+
+	stats := r.recordLatency([]checker.CheckResult{alive(100, 100, 110)}, 4)
+	if got := stats[key]; got == nil || got.Samples != 2 {
+		t.Fatalf("first cycle stats = %+v, want 2 samples", got)
+	}
+
+	// Samples carry across cycles up to the window, oldest first out
+	stats = r.recordLatency([]checker.CheckResult{alive(300, 300, 400, 500)}, 4)
+	if got := stats[key]; got == nil || got.Samples != 4 || got.P50Ms != 300 || got.MaxMs != 500 {
+		t.Fatalf("second cycle stats = %+v, want the 4 most recent samples", got)
+	}
+
+	// Without latency_samples the check latency is the only sample
+	stats = r.recordLatency([]checker.CheckResult{alive(50)}, 4)
+	if got := stats[key]; got == nil || got.Samples != 4 || got.P50Ms != 300 {
+		t.Fatalf("third cycle stats = %+v, want 4 samples", got)
+	}
+
+	// A dead proxy loses its history
+	r.recordLatency([]checker.CheckResult{{Candidate: candidate}}, 4)
+	stats = r.recordLatency([]checker.CheckResult{alive(70)}, 4)
+	if got := stats[key]; got == nil || got.Samples != 1 {
+		t.Errorf("stats after a dead cycle = %+v, want a fresh history", got)
+	}
+}
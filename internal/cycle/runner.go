@@ -0,0 +1,383 @@
+package cycle
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/proxy-checker-api/internal/aggregator"
+	"github.com/proxy-checker-api/internal/checker"
+	"github.com/proxy-checker-api/internal/geoip"
+	"github.com/proxy-checker-api/internal/snapshot"
+	"github.com/proxy-checker-api/internal/targets"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Cycle states
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Cycle phases
+const (
+	PhaseAggregating = "aggregating"
+	PhaseChecking    = "checking"
+	PhaseMeasuring   = "measuring"
+	PhaseDone        = "done"
+)
+
+// historySize is the number of finished cycles kept for GET /cycles/{id}
+const historySize = 50
+
+// Cycle describes one aggregate-and-check run
+type Cycle struct {
+	ID           string         `json:"id"`
+	Trigger      string         `json:"trigger"` // "startup", "schedule", "api" or "watch"
+	Status       string         `json:"status"`
+	Phase        string         `json:"phase"`
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   *time.Time     `json:"finished_at,omitempty"`
+	TotalScraped int            `json:"total_scraped"`
+	Filtered     map[string]int `json:"filtered,omitempty"` // dropped before checking, by reason
+	Checked      int            `json:"checked"`
+	TotalAlive   int            `json:"total_alive"`
+	TotalDead    int            `json:"total_dead"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// run is the mutable state of a cycle in progress
+type run struct {
+	mu      sync.Mutex
+	cycle   Cycle
+	checked atomic.Int64
+	done    chan struct{}
+}
+
+func (r *run) view() Cycle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.cycle
+	if c.Status == StatusRunning {
+		c.Checked = int(r.checked.Load())
+	}
+	return c
+}
+
+func (r *run) update(fn func(*Cycle)) {
+	r.mu.Lock()
+	fn(&r.cycle)
+	r.mu.Unlock()
+}
+
+// Runner executes aggregation cycles one at a time. Triggers that arrive
+// while a cycle is running are coalesced into the running cycle.
+type Runner struct {
+	ctx        context.Context
+	aggregator *aggregator.Aggregator
+	checker    *checker.Checker
+	snapshot   *snapshot.Manager
+	geoip      *geoip.Resolver
+	targets    *targets.Monitor
+
+	// latencyHistory holds recent latency samples per alive proxy key
+	latencyMu      sync.Mutex
+	latencyHistory map[string][]int64
+
+	mu      sync.Mutex
+	current *run
+	history []*run // oldest first
+	seq     uint64
+	wg      sync.WaitGroup
+}
+
+// NewRunner creates a runner whose cycles are cancelled when ctx is done
+func NewRunner(ctx context.Context, agg *aggregator.Aggregator, chk *checker.Checker, snap *snapshot.Manager,
+	geo *geoip.Resolver, monitor *targets.Monitor) *Runner {
+	return &Runner{
+		ctx:        ctx,
+		aggregator: agg,
+		checker:    chk,
+		snapshot:   snap,
+		geoip:      geo,
+		targets:    monitor,
+	}
+}
+
+// Trigger starts a cycle in the background. If one is already running its
+// ID is returned with started=false.
+func (r *Runner) Trigger(trigger string) (id string, started bool) {
+	cur, started := r.start(trigger)
+	if started {
+		go r.execute(cur)
+	}
+	return cur.cycle.ID, started
+}
+
+// Run starts a cycle and waits for it to finish. If one is already running
+// it waits for that one instead.
+func (r *Runner) Run(trigger string) Cycle {
+	cur, started := r.start(trigger)
+	if started {
+		r.execute(cur)
+	} else {
+		log.Infof("Cycle %s already running, skipping %s trigger", cur.cycle.ID, trigger)
+		<-cur.done
+	}
+	return cur.view()
+}
+
+// Get returns a running or recently finished cycle
+func (r *Runner) Get(id string) (Cycle, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil && r.current.cycle.ID == id {
+		return r.current.view(), true
+	}
+	for _, h := range r.history {
+		if h.cycle.ID == id {
+			return h.view(), true
+		}
+	}
+	return Cycle{}, false
+}
+
+// List returns the running cycle and recent history, newest first
+func (r *Runner) List() []Cycle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cycles := make([]Cycle, 0, len(r.history)+1)
+	if r.current != nil {
+		cycles = append(cycles, r.current.view())
+	}
+	for i := len(r.history) - 1; i >= 0; i-- {
+		cycles = append(cycles, r.history[i].view())
+	}
+	return cycles
+}
+
+// Wait blocks until the running cycle (if any) has returned. Cancel the
+// runner's context first to make that prompt.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Runner) start(trigger string) (*run, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil {
+		return r.current, false
+	}
+
+	r.seq++
+	now := time.Now()
+	cur := &run{
+		cycle: Cycle{
+			ID:        fmt.Sprintf("%s-%d", now.UTC().Format("20060102T150405"), r.seq),
+			Trigger:   trigger,
+			Status:    StatusRunning,
+			Phase:     PhaseAggregating,
+			StartedAt: now,
+		},
+		done: make(chan struct{}),
+	}
+	r.current = cur
+	r.wg.Add(1)
+	return cur, true
+}
+
+func (r *Runner) finish(cur *run, status string, err error) {
+	now := time.Now()
+	cur.update(func(c *Cycle) {
+		c.Status = status
+		c.Phase = PhaseDone
+		c.FinishedAt = &now
+		c.Checked = int(cur.checked.Load())
+		if err != nil {
+			c.Error = err.Error()
+		}
+	})
+
+	r.mu.Lock()
+	r.current = nil
+	r.history = append(r.history, cur)
+	if len(r.history) > historySize {
+		r.history = r.history[len(r.history)-historySize:]
+	}
+	r.mu.Unlock()
+
+	close(cur.done)
+	r.wg.Done()
+}
+
+func (r *Runner) execute(cur *run) {
+	ctx := r.ctx
+	start := time.Now()
+	log.Infof("Starting aggregation cycle %s (%s)", cur.cycle.ID, cur.cycle.Trigger)
+
+	// Fetch proxies from sources
+	proxies, sourceStats, err := r.aggregator.Aggregate(ctx)
+	if err != nil {
+		log.Errorf("Aggregation failed: %v", err)
+		r.finish(cur, r.failureStatus(), err)
+		return
+	}
+
+	log.Infof("Aggregated %d unique proxies from %d sources", len(proxies), len(sourceStats))
+
+	// Drop bogon and excluded addresses before anything is checked
+	proxies, filtered, err := r.aggregator.Filter(ctx, proxies)
+	if err != nil {
+		log.Errorf("Filtering failed: %v", err)
+		r.finish(cur, StatusFailed, err)
+		return
+	}
+	totalScraped := len(proxies)
+
+	cur.update(func(c *Cycle) {
+		c.TotalScraped = totalScraped
+		c.Filtered = filtered
+		c.Phase = PhaseChecking
+	})
+
+	if totalScraped == 0 {
+		log.Warn("No proxies aggregated, skipping check cycle")
+		r.finish(cur, StatusCompleted, nil)
+		return
+	}
+
+	// Check proxies
+	checkStart := time.Now()
+	results := r.checker.CheckProxies(ctx, proxies, func(checked int) {
+		cur.checked.Store(int64(checked))
+	})
+	checkDuration := time.Since(checkStart)
+
+	if ctx.Err() != nil {
+		// A partial check would wipe most of the pool; keep the old snapshot
+		log.Warnf("Cycle %s cancelled, snapshot not updated", cur.cycle.ID)
+		r.finish(cur, StatusCancelled, ctx.Err())
+		return
+	}
+
+	latency := r.recordLatency(results, r.checker.Config().LatencyWindow)
+
+	aliveCount := 0
+	deadCount := 0
+	aliveProxies := make([]snapshot.Proxy, 0, len(results))
+	aliveCandidates := make([]types.Candidate, 0, len(results))
+
+	for _, result := range results {
+		if result.Alive {
+			aliveCount++
+			aliveCandidates = append(aliveCandidates, result.Candidate)
+			protocol := result.Candidate.Protocol
+			if protocol == "" {
+				protocol = "http"
+			}
+			aliveProxies = append(aliveProxies, snapshot.Proxy{
+				Address:   result.Proxy,
+				Protocol:  protocol,
+				Username:  result.Candidate.Username,
+				Password:  result.Candidate.Password,
+				Country:   result.Candidate.Country,
+				Alive:     true,
+				LatencyMs: result.LatencyMs,
+				Timing:    result.Timing,
+				Latency:   latency[result.Candidate.Key()],
+				ExitIP:    result.ExitIP,
+				LastCheck: time.Now(),
+				Sources:   result.Candidate.Sources,
+			})
+		} else {
+			deadCount++
+		}
+	}
+
+	if speeds := r.measureBandwidth(ctx, cur, aliveCandidates); speeds != nil {
+		if ctx.Err() != nil {
+			log.Warnf("Cycle %s cancelled, snapshot not updated", cur.cycle.ID)
+			r.finish(cur, StatusCancelled, ctx.Err())
+			return
+		}
+		for i, speed := range speeds {
+			aliveProxies[i].BytesPerSec = speed
+		}
+	}
+
+	alivePercent := 0.0
+	if totalScraped > 0 {
+		alivePercent = float64(aliveCount) / float64(totalScraped) * 100.0
+	}
+
+	log.Infof("Check complete: %d alive, %d dead (%.2f%% alive) in %v",
+		aliveCount, deadCount, alivePercent, checkDuration)
+
+	r.geoip.Enrich(aliveProxies)
+	r.targets.Enrich(aliveProxies)
+	bySource := r.aggregator.RecordYield(proxies, aliveCandidates)
+
+	egress := make(map[string]bool, len(aliveProxies))
+	for _, proxy := range aliveProxies {
+		egress[proxy.Egress()] = true
+	}
+
+	// Update snapshot
+	stats := snapshot.Stats{
+		TotalScraped:   totalScraped,
+		TotalAlive:     aliveCount,
+		TotalDead:      deadCount,
+		AlivePercent:   alivePercent,
+		LastCheckTime:  time.Now(),
+		SourceStats:    sourceStats,
+		BySource:       bySource,
+		DistinctEgress: len(egress),
+		Filtered:       filtered,
+	}
+
+	r.snapshot.Update(aliveProxies, stats)
+
+	cur.update(func(c *Cycle) {
+		c.TotalAlive = aliveCount
+		c.TotalDead = deadCount
+	})
+	r.finish(cur, StatusCompleted, nil)
+
+	totalDuration := time.Since(start)
+	log.Infof("Aggregation cycle %s complete in %v", cur.cycle.ID, totalDuration)
+
+	// Log memory stats
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	log.Infof("Memory: Alloc=%dMB, TotalAlloc=%dMB, Sys=%dMB, NumGC=%d, Goroutines=%d",
+		m.Alloc/1024/1024, m.TotalAlloc/1024/1024, m.Sys/1024/1024, m.NumGC, runtime.NumGoroutine())
+}
+
+// measureBandwidth runs the bandwidth probe over the alive candidates when
+// it is enabled
+func (r *Runner) measureBandwidth(ctx context.Context, cur *run, alive []types.Candidate) []int64 {
+	if !r.checker.Config().Bandwidth.Enabled || len(alive) == 0 {
+		return nil
+	}
+	cur.update(func(c *Cycle) {
+		c.Phase = PhaseMeasuring
+	})
+	return r.checker.MeasureBandwidth(ctx, alive)
+}
+
+func (r *Runner) failureStatus() string {
+	if r.ctx.Err() != nil {
+		return StatusCancelled
+	}
+	return StatusFailed
+}
@@ -0,0 +1,116 @@
+package cycle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/proxy-checker-api/internal/aggregator"
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/metrics"
+)
+
+// testMetrics is shared because collectors register globally
+var testMetrics = metrics.NewCollector("cycle_test")
+
+func newTestRunner(ctx context.Context) *Runner {
+	// No sources: every executed cycle fails right after aggregating
+	agg := aggregator.NewAggregator(config.AggregatorConfig{}, testMetrics)
+	return NewRunner(ctx, agg, nil, nil, nil, nil)
+}
+
+func TestRunnerCoalescesTriggers(t *testing.T) {
+	r := newTestRunner(context.Background())
+
+	first, started := r.start("schedule")
+	if !started {
+		t.Fatal("first start did not start a cycle")
+	}
+	for _, trigger := range []string{"api", "watch", "schedule"} {
+		if id, started := r.Trigger(trigger); started || id != first.cycle.ID {
+			t.Errorf("Trigger(%s) = %s, %t; want %s, false", trigger, id, started, first.cycle.ID)
+		}
+	}
+
+	// Run waits for the running cycle instead of starting another
+	waited := make(chan Cycle)
+	go func() { waited <- r.Run("api") }()
+	select {
+	case c := <-waited:
+		t.Fatalf("Run returned %s before the running cycle finished", c.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.finish(first, StatusCompleted, nil)
+	c := <-waited
+	if c.ID != first.cycle.ID || c.Status != StatusCompleted || c.Trigger != "schedule" {
+		t.Errorf("Run = %s %s (%s), want %s completed (schedule)", c.ID, c.Status, c.Trigger, first.cycle.ID)
+	}
+
+	// Once finished, the next trigger starts a new cycle
+	second, started := r.start("api")
+	if !started || second.cycle.ID == first.cycle.ID {
+		t.Fatalf("start after finish = %s, %t; want a new cycle", second.cycle.ID, started)
+	}
+	r.finish(second, StatusCompleted, nil)
+	r.Wait()
+}
+
+func TestRunnerExecute(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel bool
+		want   string
+	}{
+		{"failure", false, StatusFailed},
+		{"cancelled", true, StatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			c := newTestRunner(ctx).Run("api")
+			if c.Status != tt.want || c.Phase != PhaseDone || c.FinishedAt == nil || c.Error == "" {
+				t.Errorf("Run = %+v, want %s in phase %s with an error", c, tt.want, PhaseDone)
+			}
+		})
+	}
+}
+
+func TestRunnerHistory(t *testing.T) {
+	r := newTestRunner(context.Background())
+
+	var ids []string
+	for i := 0; i < historySize+5; i++ {
+		c := r.Run(fmt.Sprintf("trigger-%d", i))
+		ids = append(ids, c.ID)
+	}
+
+	list := r.List()
+	if len(list) != historySize {
+		t.Fatalf("List() holds %d cycles, want %d", len(list), historySize)
+	}
+	if newest := ids[len(ids)-1]; list[0].ID != newest {
+		t.Errorf("List()[0] = %s, want the newest cycle %s", list[0].ID, newest)
+	}
+	if _, ok := r.Get(ids[0]); ok {
+		t.Errorf("Get(%s) found a cycle beyond the history size", ids[0])
+	}
+	if c, ok := r.Get(ids[len(ids)-1]); !ok || c.Status != StatusFailed {
+		t.Errorf("Get(newest) = %+v, %t; want the failed cycle", c, ok)
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("cycle ID %s reused", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,212 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Info is what the databases know about an address
+type Info struct {
+	Country string // ISO 3166-1 alpha-2
+	City    string // English name
+	ASN     uint
+	ASOrg   string
+}
+
+// record decodes the fields of City, Country and ASN databases; each
+// database fills the ones it has
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// Resolver looks addresses up in the configured databases. Each database
+// is read into memory and replaced when its file changes, so lookups never
+// see a half-written file.
+type Resolver struct {
+	ctx context.Context
+
+	mu           sync.RWMutex
+	lookupExitIP bool
+	paths        []string
+	readers      map[string]*maxminddb.Reader // nil until the file loads
+	cancel       context.CancelFunc           // stops the file watches of paths
+}
+
+// NewResolver opens the configured databases. A missing or invalid file
+// is logged and picked up once it appears; watches stop when ctx is done.
+func NewResolver(ctx context.Context, cfg config.GeoIPConfig) *Resolver {
+	r := &Resolver{ctx: ctx, readers: make(map[string]*maxminddb.Reader)}
+	r.UpdateConfig(cfg)
+	return r
+}
+
+// UpdateConfig switches to a new database list
+func (r *Resolver) UpdateConfig(cfg config.GeoIPConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookupExitIP = cfg.LookupExitIP
+	if slices.Equal(r.paths, cfg.Databases) {
+		return
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+
+	watchCtx, cancel := context.WithCancel(r.ctx)
+	r.cancel = cancel
+	r.paths = slices.Clone(cfg.Databases)
+	r.readers = make(map[string]*maxminddb.Reader, len(r.paths))
+
+	for _, path := range r.paths {
+		reader, err := open(path)
+		if err != nil {
+			log.Warnf("GeoIP database %s not loaded: %v", path, err)
+		}
+		r.readers[path] = reader
+
+		path := path
+		if err := config.Watch(watchCtx, path, func() { r.reload(path) }); err != nil {
+			log.Warnf("Cannot watch GeoIP database %s: %v", path, err)
+		}
+	}
+}
+
+func (r *Resolver) reload(path string) {
+	reader, err := open(path)
+	if err != nil {
+		log.Warnf("GeoIP database %s not reloaded, keeping the previous one: %v", path, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.readers[path]; ok {
+		r.readers[path] = reader
+	}
+}
+
+func open(path string) (*maxminddb.Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	meta := reader.Metadata
+	log.Infof("Loaded GeoIP database %s (%s, built %s)", path, meta.DatabaseType,
+		time.Unix(int64(meta.BuildEpoch), 0).UTC().Format(time.DateOnly))
+	return reader, nil
+}
+
+// Enabled reports whether any database is loaded
+func (r *Resolver) Enabled() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, reader := range r.readers {
+		if reader != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup merges what the databases know about addr, earlier databases
+// winning field by field
+func (r *Resolver) Lookup(addr netip.Addr) (Info, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ip := net.IP(addr.Unmap().AsSlice())
+	var info Info
+	found := false
+	for _, path := range r.paths {
+		reader := r.readers[path]
+		if reader == nil {
+			continue
+		}
+
+		var rec record
+		if err := reader.Lookup(ip, &rec); err != nil {
+			log.Debugf("GeoIP lookup of %s in %s: %v", addr, path, err)
+			continue
+		}
+
+		country := rec.Country.ISOCode
+		if country == "" {
+			country = rec.RegisteredCountry.ISOCode
+		}
+		if info.Country == "" && country != "" {
+			info.Country, found = country, true
+		}
+		if info.City == "" && rec.City.Names["en"] != "" {
+			info.City, found = rec.City.Names["en"], true
+		}
+		if info.ASN == 0 && rec.ASN != 0 {
+			info.ASN, info.ASOrg, found = rec.ASN, rec.ASOrg, true
+		}
+	}
+	return info, found
+}
+
+// Enrich sets the location and network of proxies whose host, or exit IP
+// with lookup_exit_ip, is an IP address. A database country replaces the
+// one published by the source.
+func (r *Resolver) Enrich(proxies []types.Proxy) {
+	if !r.Enabled() {
+		return
+	}
+	r.mu.RLock()
+	useExitIP := r.lookupExitIP
+	r.mu.RUnlock()
+
+	for i := range proxies {
+		host, _, err := net.SplitHostPort(proxies[i].Address)
+		if err != nil {
+			continue
+		}
+		if useExitIP && proxies[i].ExitIP != "" {
+			host = proxies[i].ExitIP
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			continue
+		}
+
+		info, ok := r.Lookup(addr)
+		if !ok {
+			continue
+		}
+		if info.Country != "" {
+			proxies[i].Country = info.Country
+		}
+		proxies[i].City = info.City
+		proxies[i].ASN = info.ASN
+		proxies[i].ASOrg = info.ASOrg
+	}
+}
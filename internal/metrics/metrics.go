@@ -11,6 +11,8 @@ type Collector struct {
 	checksSuccess  prometheus.Counter
 	checksFailure  prometheus.Counter
 	checkDuration  prometheus.Histogram
+	checkPhase     *prometheus.HistogramVec
+	targetProxies  *prometheus.GaugeVec
 	
 	// Proxy stats
 	aliveProxies   prometheus.Gauge
@@ -18,6 +20,11 @@ type Collector struct {
 	
 	// Aggregation metrics
 	proxiesScraped *prometheus.CounterVec
+	filtered       *prometheus.CounterVec
+	sourceUp       *prometheus.GaugeVec
+	sourceFailures *prometheus.GaugeVec
+	sourceYield    *prometheus.GaugeVec
+	sourceAlive    *prometheus.GaugeVec
 	
 	// API metrics
 	apiRequests    *prometheus.CounterVec
@@ -56,6 +63,23 @@ func NewCollector(namespace string) *Collector {
 				Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
 			},
 		),
+		checkPhase: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "check_phase_duration_seconds",
+				Help:      "Duration of each phase of successful proxy checks in seconds",
+				Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			[]string{"phase"},
+		),
+		targetProxies: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "target_proxies",
+				Help:      "Proxies by outcome of the last check against each target profile",
+			},
+			[]string{"target", "status"},
+		),
 		aliveProxies: promauto.NewGauge(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
@@ -78,6 +102,46 @@ func NewCollector(namespace string) *Collector {
 			},
 			[]string{"source"},
 		),
+		filtered: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "candidates_filtered_total",
+				Help:      "Candidates dropped before checking, by reason",
+			},
+			[]string{"reason"},
+		),
+		sourceUp: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "source_up",
+				Help:      "Whether the last fetch of a source succeeded",
+			},
+			[]string{"source"},
+		),
+		sourceFailures: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "source_consecutive_failures",
+				Help:      "Consecutive failed fetches of a source",
+			},
+			[]string{"source"},
+		),
+		sourceYield: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "source_yield_ratio",
+				Help:      "Alive proxies contributed by a source / proxies it returned, as of the last check",
+			},
+			[]string{"source"},
+		),
+		sourceAlive: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "source_alive_proxies",
+				Help:      "Alive proxies listed by a source, as of the last check",
+			},
+			[]string{"source"},
+		),
 		apiRequests: promauto.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
@@ -114,6 +178,24 @@ func (c *Collector) RecordCheckDuration(seconds float64) {
 	c.checkDuration.Observe(seconds)
 }
 
+func (c *Collector) RecordCheckPhase(phase string, seconds float64) {
+	c.checkPhase.WithLabelValues(phase).Observe(seconds)
+}
+
+// SetTargetResults records how many proxies were ok, blocked or failed at
+// a target profile's last run
+func (c *Collector) SetTargetResults(target string, counts map[string]int) {
+	c.targetProxies.DeletePartialMatch(prometheus.Labels{"target": target})
+	for status, count := range counts {
+		c.targetProxies.WithLabelValues(target, status).Set(float64(count))
+	}
+}
+
+// DeleteTarget drops the series of a removed target profile
+func (c *Collector) DeleteTarget(target string) {
+	c.targetProxies.DeletePartialMatch(prometheus.Labels{"target": target})
+}
+
 func (c *Collector) SetAliveProxies(count int) {
 	c.aliveProxies.Set(float64(count))
 }
@@ -126,6 +208,42 @@ func (c *Collector) RecordProxiesScraped(source string, count int) {
 	c.proxiesScraped.WithLabelValues(source).Add(float64(count))
 }
 
+func (c *Collector) RecordCandidatesFiltered(reason string, count int) {
+	c.filtered.WithLabelValues(reason).Add(float64(count))
+}
+
+// SetSourceHealth records the outcome of a source fetch; source is the
+// source name
+func (c *Collector) SetSourceHealth(source string, up bool, consecutiveFailures int) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	c.sourceUp.WithLabelValues(source).Set(value)
+	c.sourceFailures.WithLabelValues(source).Set(float64(consecutiveFailures))
+}
+
+// SetSourceYield records a source's alive proxies and yield after a check
+func (c *Collector) SetSourceYield(source string, alive int, yield float64) {
+	c.sourceYield.WithLabelValues(source).Set(yield)
+	c.sourceAlive.WithLabelValues(source).Set(float64(alive))
+}
+
+// ResetSourceYield drops the yield series before a check's results are
+// recorded, so sources that no longer contribute disappear
+func (c *Collector) ResetSourceYield() {
+	c.sourceYield.Reset()
+	c.sourceAlive.Reset()
+}
+
+// DeleteSource drops the per-source health series of a removed source
+func (c *Collector) DeleteSource(source string) {
+	c.sourceUp.DeleteLabelValues(source)
+	c.sourceFailures.DeleteLabelValues(source)
+	c.sourceYield.DeleteLabelValues(source)
+	c.sourceAlive.DeleteLabelValues(source)
+}
+
 func (c *Collector) RecordAPIRequest(method, endpoint, status string) {
 	c.apiRequests.WithLabelValues(method, endpoint, status).Inc()
 }
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter decides whether a request identified by key is within its
+// per-minute budget. Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, requestsPerMinute int) (bool, error)
+	Close() error
+}
+
+func NewLimiter(backend string, redisAddr string) (Limiter, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemoryLimiter(10 * time.Minute), nil
+	case "redis":
+		return NewRedisLimiter(redisAddr)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend: %s", backend)
+	}
+}
+
+// burstFor mirrors the historical behaviour of allowing a tenth of the
+// per-minute budget as a burst
+func burstFor(requestsPerMinute int) int {
+	burst := requestsPerMinute / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return burst
+}
+
+type memoryEntry struct {
+	limiter           *rate.Limiter
+	requestsPerMinute int
+	lastSeen          time.Time
+}
+
+// MemoryLimiter keeps token buckets in process memory. Entries that have not
+// been used for idleTTL are evicted in the background.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	idleTTL time.Duration
+	stop    chan struct{}
+}
+
+func NewMemoryLimiter(idleTTL time.Duration) *MemoryLimiter {
+	m := &MemoryLimiter{
+		entries: make(map[string]*memoryEntry),
+		idleTTL: idleTTL,
+		stop:    make(chan struct{}),
+	}
+
+	go m.evictLoop()
+
+	return m
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, requestsPerMinute int) (bool, error) {
+	if requestsPerMinute <= 0 {
+		return true, nil
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	entry, exists := m.entries[key]
+	if !exists || entry.requestsPerMinute != requestsPerMinute {
+		// (Re)create when the key is new or its configured rate changed
+		entry = &memoryEntry{
+			limiter:           rate.NewLimiter(rate.Limit(float64(requestsPerMinute)/60.0), burstFor(requestsPerMinute)),
+			requestsPerMinute: requestsPerMinute,
+		}
+		m.entries[key] = entry
+	}
+	entry.lastSeen = now
+	m.mu.Unlock()
+
+	return entry.limiter.AllowN(now, 1), nil
+}
+
+// Len returns the number of tracked keys
+func (m *MemoryLimiter) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+func (m *MemoryLimiter) evictLoop() {
+	interval := m.idleTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.evictIdle()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *MemoryLimiter) evictIdle() {
+	cutoff := time.Now().Add(-m.idleTTL)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, entry := range m.entries {
+		if entry.lastSeen.Before(cutoff) {
+			delete(m.entries, key)
+		}
+	}
+}
+
+func (m *MemoryLimiter) Close() error {
+	close(m.stop)
+	return nil
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBurstFor(t *testing.T) {
+	tests := []struct {
+		requestsPerMinute int
+		want              int
+	}{
+		{1, 1},
+		{9, 1},
+		{10, 1},
+		{60, 6},
+		{600, 60},
+	}
+
+	for _, tt := range tests {
+		if got := burstFor(tt.requestsPerMinute); got != tt.want {
+			t.Errorf("burstFor(%d) = %d, want %d", tt.requestsPerMinute, got, tt.want)
+		}
+	}
+}
+
+// allowedInARow counts the requests allowed before the first denial
+func allowedInARow(t *testing.T, l Limiter, key string, requestsPerMinute, max int) int {
+	t.Helper()
+	for i := 0; i < max; i++ {
+		ok, err := l.Allow(context.Background(), key, requestsPerMinute)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if !ok {
+			return i
+		}
+	}
+	return max
+}
+
+func TestMemoryLimiterBurst(t *testing.T) {
+	tests := []struct {
+		name              string
+		requestsPerMinute int
+		want              int
+	}{
+		{"unlimited", 0, 100},
+		{"negative is unlimited", -1, 100},
+		{"minimum burst", 5, 1},
+		{"tenth of the budget", 60, 6},
+		{"large budget", 1200, 100}, // burst 120, capped by the probe count
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewMemoryLimiter(time.Minute)
+			defer l.Close()
+			if got := allowedInARow(t, l, "key", tt.requestsPerMinute, 100); got != tt.want {
+				t.Errorf("allowed %d requests in a row, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterKeys(t *testing.T) {
+	l := NewMemoryLimiter(time.Minute)
+	defer l.Close()
+
+	if got := allowedInARow(t, l, "a", 60, 20); got != 6 {
+		t.Fatalf("key a: allowed %d, want 6", got)
+	}
+	// Keys have separate budgets
+	if got := allowedInARow(t, l, "b", 60, 20); got != 6 {
+		t.Errorf("key b: allowed %d, want 6", got)
+	}
+	// A changed rate starts a fresh bucket
+	if got := allowedInARow(t, l, "a", 120, 20); got != 12 {
+		t.Errorf("key a at a new rate: allowed %d, want 12", got)
+	}
+}
+
+func TestMemoryLimiterEvictIdle(t *testing.T) {
+	l := NewMemoryLimiter(time.Minute)
+	defer l.Close()
+
+	for _, key := range []string{"idle", "recent"} {
+		if _, err := l.Allow(context.Background(), key, 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.mu.Lock()
+	l.entries["idle"].lastSeen = time.Now().Add(-2 * time.Minute)
+	l.mu.Unlock()
+
+	l.evictIdle()
+
+	if got := l.Len(); got != 1 {
+		t.Fatalf("Len() after eviction = %d, want 1", got)
+	}
+	l.mu.Lock()
+	_, kept := l.entries["recent"]
+	l.mu.Unlock()
+	if !kept {
+		t.Error("recently used key evicted")
+	}
+
+	// Unlimited requests are not tracked at all
+	if _, err := l.Allow(context.Background(), "unlimited", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Len(); got != 1 {
+		t.Errorf("Len() after unlimited request = %d, want 1", got)
+	}
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript implements the generic cell rate algorithm. The theoretical
+// arrival time (TAT) of the next request is stored per key; a request is
+// allowed when it would not push the TAT more than burst intervals ahead of
+// now. Redis server time is used so replicas with skewed clocks agree.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval
+if newTat - now > interval * burst then
+	return 0
+end
+
+redis.call('SET', KEYS[1], newTat, 'PX', math.ceil(newTat - now))
+return 1
+`)
+
+// RedisLimiter shares rate limit state between replicas through Redis
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLimiter(addr string) (*RedisLimiter, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
+
+	return &RedisLimiter{
+		client: client,
+		prefix: "proxychecker:ratelimit:",
+	}, nil
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, requestsPerMinute int) (bool, error) {
+	if requestsPerMinute <= 0 {
+		return true, nil
+	}
+
+	intervalMs := 60000.0 / float64(requestsPerMinute)
+
+	allowed, err := gcraScript.Run(ctx, r.client, []string{r.prefix + key},
+		intervalMs, burstFor(requestsPerMinute)).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis rate limit: %w", err)
+	}
+
+	return allowed == 1, nil
+}
+
+func (r *RedisLimiter) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestRedisLimiter connects to the Redis server named by
+// PROXYCHECKER_TEST_REDIS, e.g. localhost:6379, or skips the test
+func newTestRedisLimiter(t *testing.T) *RedisLimiter {
+	t.Helper()
+	addr := os.Getenv("PROXYCHECKER_TEST_REDIS")
+	if addr == "" {
+		t.Skip("PROXYCHECKER_TEST_REDIS not set")
+	}
+	l, err := NewRedisLimiter(addr)
+	if err != nil {
+		t.Fatalf("NewRedisLimiter: %v", err)
+	}
+	l.prefix = fmt.Sprintf("proxychecker:test:%d:", time.Now().UnixNano())
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestRedisLimiterGCRA(t *testing.T) {
+	tests := []struct {
+		name              string
+		requestsPerMinute int
+		want              int
+	}{
+		{"unlimited", 0, 50},
+		{"minimum burst", 5, 1},
+		{"tenth of the budget", 60, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestRedisLimiter(t)
+			if got := allowedInARow(t, l, "key", tt.requestsPerMinute, 50); got != tt.want {
+				t.Errorf("allowed %d requests in a row, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisLimiterRecovers(t *testing.T) {
+	l := newTestRedisLimiter(t)
+
+	// 600/min: one request per 100ms, a burst of 60
+	if got := allowedInARow(t, l, "key", 600, 100); got != 60 {
+		t.Fatalf("allowed %d requests in a row, want 60", got)
+	}
+	if got := allowedInARow(t, l, "other", 600, 100); got != 60 {
+		t.Errorf("other key: allowed %d, want 60", got)
+	}
+
+	// The theoretical arrival time advances one interval per request
+	time.Sleep(250 * time.Millisecond)
+	if got := allowedInARow(t, l, "key", 600, 100); got != 2 {
+		t.Errorf("allowed %d requests after 250ms, want 2", got)
+	}
+}
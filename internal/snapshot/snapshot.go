@@ -18,6 +18,7 @@ type Snapshot = types.Snapshot
 
 type Manager struct {
 	current   atomic.Value // stores *Snapshot
+	updateMu  sync.Mutex   // serializes Update and Annotate
 	storage   storage.Storage
 	persistMu sync.Mutex
 	rrIndex   atomic.Uint64 // Round-robin index
@@ -50,6 +51,9 @@ func NewManager(store storage.Storage, persistIntervalSeconds int) *Manager {
 
 // Update atomically swaps the current snapshot
 func (m *Manager) Update(proxies []types.Proxy, stats types.Stats) {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+
 	snapshot := &types.Snapshot{
 		Proxies: proxies,
 		Stats:   stats,
@@ -63,6 +67,27 @@ func (m *Manager) Update(proxies []types.Proxy, stats types.Stats) {
 	go m.persist(snapshot)
 }
 
+// Annotate replaces the current snapshot with a copy whose proxies fn has
+// modified, keeping its statistics. The copy is persisted with the next
+// periodic save.
+func (m *Manager) Annotate(fn func(*types.Proxy)) {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+
+	current := m.Get()
+	proxies := make([]types.Proxy, len(current.Proxies))
+	copy(proxies, current.Proxies)
+	for i := range proxies {
+		fn(&proxies[i])
+	}
+
+	m.current.Store(&types.Snapshot{
+		Proxies: proxies,
+		Stats:   current.Stats,
+		Updated: current.Updated,
+	})
+}
+
 // Get returns the current snapshot (atomic read)
 func (m *Manager) Get() *types.Snapshot {
 	return m.current.Load().(*types.Snapshot)
@@ -82,8 +107,13 @@ func (m *Manager) GetProxy() (types.Proxy, bool) {
 
 // GetProxies returns N proxies (round-robin or random)
 func (m *Manager) GetProxies(n int) []types.Proxy {
-	snapshot := m.Get()
-	total := len(snapshot.Proxies)
+	return m.Select(m.Get().Proxies, n)
+}
+
+// Select returns N proxies of pool, a subset of the current snapshot, the
+// same way GetProxies does
+func (m *Manager) Select(pool []types.Proxy, n int) []types.Proxy {
+	total := len(pool)
 
 	if total == 0 {
 		return []types.Proxy{}
@@ -100,7 +130,7 @@ func (m *Manager) GetProxies(n int) []types.Proxy {
 		startIdx := int(m.rrIndex.Add(uint64(n)) % uint64(total))
 		for i := 0; i < n; i++ {
 			idx := (startIdx + i) % total
-			result[i] = snapshot.Proxies[idx]
+			result[i] = pool[idx]
 		}
 		return result
 	}
@@ -108,7 +138,7 @@ func (m *Manager) GetProxies(n int) []types.Proxy {
 	// Random sampling for larger requests
 	indices := rand.Perm(total)
 	for i := 0; i < n; i++ {
-		result[i] = snapshot.Proxies[indices[i]]
+		result[i] = pool[indices[i]]
 	}
 
 	return result
@@ -123,6 +153,18 @@ func (m *Manager) GetAll() []types.Proxy {
 	return proxies
 }
 
+// Filter returns the proxies of the current snapshot that match
+func (m *Manager) Filter(match func(types.Proxy) bool) []types.Proxy {
+	snapshot := m.Get()
+	proxies := make([]types.Proxy, 0)
+	for _, proxy := range snapshot.Proxies {
+		if match(proxy) {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // GetStats returns current statistics
 func (m *Manager) GetStats() types.Stats {
 	snapshot := m.Get()
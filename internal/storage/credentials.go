@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// credentialPrefix marks an encrypted credential in a stored snapshot, or
+// an encrypted blob
+const credentialPrefix = "enc:"
+
+// CredentialStorage encrypts with AES-256-GCM before data reaches the
+// backend and decrypts on load: proxy credentials in snapshots, and blobs
+// (sources with their request headers and auth, API key hashes, source
+// health) as a whole. Without a key, proxies with credentials are left out
+// of saved snapshots and blobs are stored unencrypted.
+type CredentialStorage struct {
+	Storage
+	aead     cipher.AEAD // nil without a key
+	warnOnce sync.Once
+}
+
+// NewCredentialStorage wraps store. key is a base64-encoded 32-byte key,
+// or empty to keep credentials out of snapshots and store blobs as is.
+func NewCredentialStorage(store Storage, key string) (Storage, error) {
+	s := &CredentialStorage{Storage: store}
+	if key == "" {
+		return s, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("credentials key must be 32 bytes, base64-encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("credentials key: %w", err)
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("credentials key: %w", err)
+	}
+	return s, nil
+}
+
+func (s *CredentialStorage) Save(snapshot *types.Snapshot) error {
+	stored := *snapshot
+	stored.Proxies = make([]types.Proxy, 0, len(snapshot.Proxies))
+	skipped := 0
+	for _, proxy := range snapshot.Proxies {
+		if proxy.HasCredentials() {
+			if s.aead == nil {
+				skipped++
+				continue
+			}
+			var err error
+			if proxy.Username, err = s.seal(proxy.Username, proxy.Address); err != nil {
+				return fmt.Errorf("encrypt credentials: %w", err)
+			}
+			if proxy.Password, err = s.seal(proxy.Password, proxy.Address); err != nil {
+				return fmt.Errorf("encrypt credentials: %w", err)
+			}
+		}
+		stored.Proxies = append(stored.Proxies, proxy)
+	}
+
+	if skipped > 0 {
+		s.warnOnce.Do(func() {
+			log.Warnf("No credentials key configured, %d proxies with credentials are not persisted", skipped)
+		})
+	}
+	return s.Storage.Save(&stored)
+}
+
+func (s *CredentialStorage) Load() (*types.Snapshot, error) {
+	snapshot, err := s.Storage.Load()
+	if err != nil || snapshot == nil {
+		return snapshot, err
+	}
+
+	proxies := make([]types.Proxy, 0, len(snapshot.Proxies))
+	dropped := 0
+	for _, proxy := range snapshot.Proxies {
+		username, userErr := s.open(proxy.Username, proxy.Address)
+		password, passErr := s.open(proxy.Password, proxy.Address)
+		if userErr != nil || passErr != nil {
+			dropped++
+			continue
+		}
+		proxy.Username, proxy.Password = username, password
+		proxies = append(proxies, proxy)
+	}
+
+	if dropped > 0 {
+		log.Warnf("Dropped %d stored proxies whose credentials cannot be decrypted (key missing or changed)", dropped)
+	}
+	snapshot.Proxies = proxies
+	return snapshot, nil
+}
+
+// SaveBlob encrypts the blob when a key is configured
+func (s *CredentialStorage) SaveBlob(name string, data []byte) error {
+	if s.aead == nil {
+		return s.Storage.SaveBlob(name, data)
+	}
+	sealed, err := s.seal(string(data), name)
+	if err != nil {
+		return fmt.Errorf("encrypt %s: %w", name, err)
+	}
+	return s.Storage.SaveBlob(name, []byte(sealed))
+}
+
+// LoadBlob decrypts a blob saved with a key; blobs saved without one are
+// returned as is, so enabling the key migrates them on their next save
+func (s *CredentialStorage) LoadBlob(name string) ([]byte, error) {
+	data, err := s.Storage.LoadBlob(name)
+	if err != nil || data == nil {
+		return data, err
+	}
+	plain, err := s.open(string(data), name)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", name, err)
+	}
+	return []byte(plain), nil
+}
+
+// seal encrypts value, binding it to the proxy address or blob name
+func (s *CredentialStorage) seal(value, aad string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), []byte(aad))
+	return credentialPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value written by seal; other values are returned as is
+func (s *CredentialStorage) open(value, aad string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, credentialPrefix)
+	if !ok {
+		return value, nil
+	}
+	if s.aead == nil {
+		return "", fmt.Errorf("encrypted, but no credentials key is configured")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("malformed ciphertext")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/proxy-checker-api/internal/types"
+)
+
+// memStorage keeps what the credential layer hands to the backend
+type memStorage struct {
+	snapshot *types.Snapshot
+	blobs    map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{blobs: make(map[string][]byte)}
+}
+
+func (m *memStorage) Save(snapshot *types.Snapshot) error {
+	stored := *snapshot
+	stored.Proxies = append([]types.Proxy(nil), snapshot.Proxies...)
+	m.snapshot = &stored
+	return nil
+}
+
+func (m *memStorage) Load() (*types.Snapshot, error) {
+	if m.snapshot == nil {
+		return nil, nil
+	}
+	loaded := *m.snapshot
+	loaded.Proxies = append([]types.Proxy(nil), m.snapshot.Proxies...)
+	return &loaded, nil
+}
+
+func (m *memStorage) SaveBlob(name string, data []byte) error {
+	m.blobs[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memStorage) LoadBlob(name string) ([]byte, error) {
+	return m.blobs[name], nil
+}
+
+func (m *memStorage) Close() error { return nil }
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func newTestCredentialStorage(t *testing.T, backend Storage, key string) Storage {
+	t.Helper()
+	s, err := NewCredentialStorage(backend, key)
+	if err != nil {
+		t.Fatalf("NewCredentialStorage: %v", err)
+	}
+	return s
+}
+
+var testProxies = []types.Proxy{
+	{Address: "1.2.3.4:8080", Protocol: "http", Alive: true},
+	{Address: "5.6.7.8:1080", Protocol: "socks5", Username: "user", Password: "p@ss", Alive: true},
+	{Address: "9.9.9.9:3128", Protocol: "http", Username: "token", Alive: true},
+}
+
+func TestNewCredentialStorageInvalidKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"not base64", "not a key!"},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		{"too long", base64.StdEncoding.EncodeToString(make([]byte, 33))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCredentialStorage(newMemStorage(), tt.key); err == nil {
+				t.Errorf("NewCredentialStorage(%q) succeeded, want error", tt.key)
+			}
+		})
+	}
+}
+
+func TestCredentialStorageRoundTrip(t *testing.T) {
+	backend := newMemStorage()
+	s := newTestCredentialStorage(t, backend, testKey(1))
+
+	if err := s.Save(&types.Snapshot{Proxies: testProxies}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Nothing readable reaches the backend
+	for _, stored := range backend.snapshot.Proxies {
+		for _, value := range []string{stored.Username, stored.Password} {
+			if value != "" && !strings.HasPrefix(value, credentialPrefix) {
+				t.Errorf("%s: credential stored in the clear: %q", stored.Address, value)
+			}
+		}
+	}
+
+	loaded, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Proxies) != len(testProxies) {
+		t.Fatalf("Load returned %d proxies, want %d", len(loaded.Proxies), len(testProxies))
+	}
+	for i, proxy := range loaded.Proxies {
+		want := testProxies[i]
+		if proxy.Address != want.Address || proxy.Username != want.Username || proxy.Password != want.Password {
+			t.Errorf("proxy %d = %s %q:%q, want %s %q:%q", i, proxy.Address, proxy.Username, proxy.Password,
+				want.Address, want.Username, want.Password)
+		}
+	}
+}
+
+func TestCredentialStorageWithoutKey(t *testing.T) {
+	backend := newMemStorage()
+	s := newTestCredentialStorage(t, backend, "")
+
+	if err := s.Save(&types.Snapshot{Proxies: testProxies}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// Proxies with credentials are refused rather than stored in the clear
+	if got := backend.snapshot.Proxies; len(got) != 1 || got[0].Address != "1.2.3.4:8080" {
+		t.Fatalf("backend holds %+v, want only the proxy without credentials", got)
+	}
+}
+
+func TestCredentialStorageLoadDropsUndecryptable(t *testing.T) {
+	tests := []struct {
+		name    string
+		loadKey string
+	}{
+		{"key removed", ""},
+		{"key changed", testKey(2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newMemStorage()
+			if err := newTestCredentialStorage(t, backend, testKey(1)).Save(&types.Snapshot{Proxies: testProxies}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			loaded, err := newTestCredentialStorage(t, backend, tt.loadKey).Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if len(loaded.Proxies) != 1 || loaded.Proxies[0].Address != "1.2.3.4:8080" {
+				t.Errorf("Load = %+v, want only the proxy without credentials", loaded.Proxies)
+			}
+		})
+	}
+}
+
+func TestCredentialStorageSealBindsAddress(t *testing.T) {
+	backend := newMemStorage()
+	s := newTestCredentialStorage(t, backend, testKey(1))
+	if err := s.Save(&types.Snapshot{Proxies: testProxies[1:2]}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Ciphertext moved to another proxy does not decrypt
+	backend.snapshot.Proxies[0].Address = "6.6.6.6:1080"
+	loaded, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Proxies) != 0 {
+		t.Errorf("Load = %+v, want the moved credentials dropped", loaded.Proxies)
+	}
+}
+
+func TestCredentialStorageBlobs(t *testing.T) {
+	data := []byte(`[{"name":"src","request":{"headers":{"Authorization":"Bearer secret"}}}]`)
+
+	t.Run("encrypted with a key", func(t *testing.T) {
+		backend := newMemStorage()
+		s := newTestCredentialStorage(t, backend, testKey(1))
+		if err := s.SaveBlob("sources", data); err != nil {
+			t.Fatalf("SaveBlob: %v", err)
+		}
+		if bytes.Contains(backend.blobs["sources"], []byte("secret")) {
+			t.Error("blob stored in the clear")
+		}
+		got, err := s.LoadBlob("sources")
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("LoadBlob = %q, %v; want the saved data", got, err)
+		}
+
+		// A blob is bound to its name
+		backend.blobs["other"] = backend.blobs["sources"]
+		if _, err := s.LoadBlob("other"); err == nil {
+			t.Error("blob copied under another name decrypted")
+		}
+		// ...and cannot be read without the key
+		if _, err := newTestCredentialStorage(t, backend, "").LoadBlob("sources"); err == nil {
+			t.Error("encrypted blob loaded without a key")
+		}
+	})
+
+	t.Run("plain blobs migrate", func(t *testing.T) {
+		backend := newMemStorage()
+		if err := newTestCredentialStorage(t, backend, "").SaveBlob("sources", data); err != nil {
+			t.Fatalf("SaveBlob: %v", err)
+		}
+		got, err := newTestCredentialStorage(t, backend, testKey(1)).LoadBlob("sources")
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("LoadBlob of a plain blob with a key = %q, %v; want the data as is", got, err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		got, err := newTestCredentialStorage(t, newMemStorage(), testKey(1)).LoadBlob("sources")
+		if got != nil || err != nil {
+			t.Errorf("LoadBlob of a missing blob = %q, %v; want nil, nil", got, err)
+		}
+	})
+}
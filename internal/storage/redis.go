@@ -74,6 +74,34 @@ func (r *RedisStorage) Load() (*types.Snapshot, error) {
 	return &snap, nil
 }
 
+func (r *RedisStorage) SaveBlob(name string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.client.Set(ctx, r.blobKey(name), data, 0).Err(); err != nil {
+		return fmt.Errorf("redis set: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) LoadBlob(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := r.client.Get(ctx, r.blobKey(name)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("redis get: %w", err)
+	}
+	return data, nil
+}
+
+func (r *RedisStorage) blobKey(name string) string {
+	return "proxychecker:" + name
+}
+
 func (r *RedisStorage) Close() error {
 	return r.client.Close()
 }
@@ -27,6 +27,11 @@ func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
 		data TEXT NOT NULL,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS blobs (
+		name TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 	if _, err := db.Exec(schema); err != nil {
 		return nil, fmt.Errorf("create table: %w", err)
@@ -82,6 +87,28 @@ func (s *SQLiteStorage) Load() (*types.Snapshot, error) {
 	return &snap, nil
 }
 
+func (s *SQLiteStorage) SaveBlob(name string, data []byte) error {
+	_, err := s.db.Exec(`INSERT INTO blobs (name, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		name, data, time.Now())
+	if err != nil {
+		return fmt.Errorf("upsert blob: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) LoadBlob(name string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow("SELECT data FROM blobs WHERE name = ?", name).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query blob: %w", err)
+	}
+	return data, nil
+}
+
 func (s *SQLiteStorage) Close() error {
 	return s.db.Close()
 }
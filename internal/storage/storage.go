@@ -12,6 +12,10 @@ import (
 type Storage interface {
 	Save(snapshot *types.Snapshot) error
 	Load() (*types.Snapshot, error)
+	// SaveBlob stores an auxiliary named document (API keys, source lists, ...)
+	SaveBlob(name string, data []byte) error
+	// LoadBlob returns a named document, or nil if it was never saved
+	LoadBlob(name string) ([]byte, error)
 	Close() error
 }
 
@@ -79,6 +83,36 @@ func (f *FileStorage) Load() (*types.Snapshot, error) {
 	return &snap, nil
 }
 
+// SaveBlob writes the document next to the snapshot file as <name>.json
+func (f *FileStorage) SaveBlob(name string, data []byte) error {
+	path := f.blobPath(name)
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("write temp file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("atomic rename: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FileStorage) LoadBlob(name string) ([]byte, error) {
+	data, err := os.ReadFile(f.blobPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	return data, nil
+}
+
+func (f *FileStorage) blobPath(name string) string {
+	return filepath.Join(filepath.Dir(f.path), name+".json")
+}
+
 func (f *FileStorage) Close() error {
 	return nil
 }
@@ -0,0 +1,233 @@
+package targets
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/proxy-checker-api/internal/checker"
+	"github.com/proxy-checker-api/internal/config"
+	"github.com/proxy-checker-api/internal/metrics"
+	"github.com/proxy-checker-api/internal/snapshot"
+	"github.com/proxy-checker-api/internal/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// emptyRetry is how soon a profile runs again when there were no alive
+// proxies to check
+const emptyRetry = time.Minute
+
+// Monitor checks the alive proxies against each target profile on the
+// profile's own interval, independently of check cycles, and keeps the
+// latest status of every proxy per profile
+type Monitor struct {
+	checker  *checker.Checker
+	snapshot *snapshot.Manager
+	metrics  *metrics.Collector
+	wake     chan struct{}
+
+	mu       sync.Mutex
+	profiles []config.TargetProfile
+	nextRun  map[string]time.Time                     // by profile name; zero means due now
+	results  map[string]map[string]types.TargetStatus // by profile name, then proxy key
+}
+
+// NewMonitor creates a monitor for the given profiles; call Run to start it
+func NewMonitor(chk *checker.Checker, snap *snapshot.Manager, metricsCollector *metrics.Collector,
+	profiles []config.TargetProfile) *Monitor {
+	return &Monitor{
+		checker:  chk,
+		snapshot: snap,
+		metrics:  metricsCollector,
+		wake:     make(chan struct{}, 1),
+		profiles: profiles,
+		nextRun:  make(map[string]time.Time),
+		results:  make(map[string]map[string]types.TargetStatus),
+	}
+}
+
+// UpdateConfig switches to a new profile list. Results of unchanged
+// profiles are kept; new and changed profiles run right away.
+func (m *Monitor) UpdateConfig(profiles []config.TargetProfile) {
+	m.mu.Lock()
+	old := make(map[string]config.TargetProfile, len(m.profiles))
+	for _, profile := range m.profiles {
+		old[profile.Name] = profile
+	}
+	for _, profile := range profiles {
+		if previous, ok := old[profile.Name]; !ok || !reflect.DeepEqual(previous, profile) {
+			delete(m.results, profile.Name)
+			delete(m.nextRun, profile.Name)
+		}
+		delete(old, profile.Name)
+	}
+	for name := range old {
+		delete(m.results, name)
+		delete(m.nextRun, name)
+		m.metrics.DeleteTarget(name)
+	}
+	m.profiles = profiles
+	m.mu.Unlock()
+
+	m.publish()
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks profiles when they are due until ctx is done. Profiles due at
+// the same time run one after another.
+func (m *Monitor) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(m.untilNextRun(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-m.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		for _, profile := range m.dueProfiles(time.Now()) {
+			m.runProfile(ctx, profile)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// untilNextRun returns how long Run may sleep, at most a minute
+func (m *Monitor) untilNextRun(now time.Time) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wait := time.Minute
+	for _, profile := range m.profiles {
+		if d := m.nextRun[profile.Name].Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+func (m *Monitor) dueProfiles(now time.Time) []config.TargetProfile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []config.TargetProfile
+	for _, profile := range m.profiles {
+		if !now.Before(m.nextRun[profile.Name]) {
+			due = append(due, profile)
+		}
+	}
+	return due
+}
+
+func (m *Monitor) runProfile(ctx context.Context, profile config.TargetProfile) {
+	start := time.Now()
+	proxies := m.snapshot.GetAll()
+	if len(proxies) == 0 {
+		retry := time.Duration(profile.IntervalSeconds) * time.Second
+		if retry > emptyRetry {
+			retry = emptyRetry
+		}
+		m.mu.Lock()
+		m.nextRun[profile.Name] = start.Add(retry)
+		m.mu.Unlock()
+		return
+	}
+
+	log.Infof("Checking %d proxies against target %s", len(proxies), profile.Name)
+	candidates := make([]types.Candidate, len(proxies))
+	for i, proxy := range proxies {
+		candidates[i] = proxy.Candidate()
+	}
+
+	statuses, err := m.checker.CheckTarget(ctx, profile, candidates)
+	if err != nil {
+		log.Errorf("Target %s not checked: %v", profile.Name, err)
+		m.mu.Lock()
+		m.nextRun[profile.Name] = time.Now().Add(time.Duration(profile.IntervalSeconds) * time.Second)
+		m.mu.Unlock()
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	results := make(map[string]types.TargetStatus, len(statuses))
+	counts := map[string]int{types.TargetOK: 0, types.TargetBlocked: 0, types.TargetFailed: 0}
+	for i, status := range statuses {
+		if status.Status == "" {
+			continue
+		}
+		results[candidates[i].Key()] = status
+		counts[status.Status]++
+	}
+
+	m.mu.Lock()
+	if !m.isCurrent(profile) {
+		// Changed or removed while running; the new version runs instead
+		m.mu.Unlock()
+		return
+	}
+	m.results[profile.Name] = results
+	m.nextRun[profile.Name] = time.Now().Add(time.Duration(profile.IntervalSeconds) * time.Second)
+	m.mu.Unlock()
+
+	m.metrics.SetTargetResults(profile.Name, counts)
+	m.publish()
+	log.Infof("Target %s: %d ok, %d blocked, %d failed of %d proxies in %v", profile.Name,
+		counts[types.TargetOK], counts[types.TargetBlocked], counts[types.TargetFailed], len(proxies), time.Since(start))
+}
+
+// isCurrent reports whether profile is still configured unchanged; m.mu
+// must be held
+func (m *Monitor) isCurrent(profile config.TargetProfile) bool {
+	for _, current := range m.profiles {
+		if current.Name == profile.Name {
+			return reflect.DeepEqual(current, profile)
+		}
+	}
+	return false
+}
+
+// Enrich sets the latest target statuses on proxies
+func (m *Monitor) Enrich(proxies []types.Proxy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range proxies {
+		proxies[i].Targets = m.statusesLocked(proxies[i].Candidate().Key())
+	}
+}
+
+// publish brings the target statuses of the current snapshot up to date
+func (m *Monitor) publish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshot.Annotate(func(proxy *types.Proxy) {
+		proxy.Targets = m.statusesLocked(proxy.Candidate().Key())
+	})
+}
+
+func (m *Monitor) statusesLocked(key string) map[string]types.TargetStatus {
+	var statuses map[string]types.TargetStatus
+	for name, results := range m.results {
+		if status, ok := results[key]; ok {
+			if statuses == nil {
+				statuses = make(map[string]types.TargetStatus)
+			}
+			statuses[name] = status
+		}
+	}
+	return statuses
+}
@@ -1,25 +1,227 @@
 package types
 
-import "time"
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
 
 // Proxy represents a single proxy server
 type Proxy struct {
-	Address   string    `json:"address"`
-	Protocol  string    `json:"protocol"` // "http" or "socks5"
-	Alive     bool      `json:"alive"`
-	LatencyMs int64     `json:"latency_ms"`
-	LastCheck time.Time `json:"last_check"`
+	Address     string                  `json:"address"`
+	Protocol    string                  `json:"protocol"` // "http" or "socks5"
+	Username    string                  `json:"username,omitempty"`
+	Password    string                  `json:"password,omitempty"`
+	Redacted    bool                    `json:"credentials_redacted,omitempty"` // credentials withheld from this caller
+	Country     string                  `json:"country,omitempty"`
+	City        string                  `json:"city,omitempty"`
+	ASN         uint                    `json:"asn,omitempty"`
+	ASOrg       string                  `json:"as_org,omitempty"`
+	ExitIP      string                  `json:"exit_ip,omitempty"`       // address the test URL saw, when detected
+	BytesPerSec int64                   `json:"bytes_per_sec,omitempty"` // measured download throughput
+	Alive       bool                    `json:"alive"`
+	LatencyMs   int64                   `json:"latency_ms"`
+	Timing      *Timing                 `json:"timing,omitempty"`  // phases of the last successful check
+	Latency     *Latency                `json:"latency,omitempty"` // statistics over recent latency samples
+	Targets     map[string]TargetStatus `json:"targets,omitempty"` // last result per target profile
+	LastCheck   time.Time               `json:"last_check"`
+	Sources     []string                `json:"sources,omitempty"` // names of the sources that listed it
+}
+
+// Timing breaks a successful check down by phase, in milliseconds. Phases
+// that did not happen (DNS for an IP address, TLS for a plain HTTP target,
+// everything but TTFB on a reused connection) are 0.
+type Timing struct {
+	DNSMs       float64 `json:"dns_ms"`
+	ConnectMs   float64 `json:"connect_ms"`   // TCP connect to the proxy
+	HandshakeMs float64 `json:"handshake_ms"` // CONNECT or SOCKS negotiation with the proxy
+	TLSMs       float64 `json:"tls_ms"`
+	TTFBMs      float64 `json:"ttfb_ms"` // request written to first response byte
+}
+
+// Latency summarizes a proxy's recent latency samples
+type Latency struct {
+	Samples  int     `json:"samples"`
+	P50Ms    int64   `json:"p50_ms"`
+	P90Ms    int64   `json:"p90_ms"`
+	MaxMs    int64   `json:"max_ms"`
+	JitterMs float64 `json:"jitter_ms"` // mean difference between consecutive samples
+}
+
+// Target check outcomes
+const (
+	TargetOK      = "ok"
+	TargetBlocked = "blocked" // a block signature matched
+	TargetFailed  = "failed"  // no response, or one that does not meet the success criteria
+)
+
+// TargetStatus is the result of checking a proxy against a target profile
+type TargetStatus struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	LatencyMs int64     `json:"latency_ms,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// WorksFor reports whether the last check against each of the target
+// profiles succeeded
+func (p Proxy) WorksFor(targets ...string) bool {
+	for _, target := range targets {
+		if p.Targets[target].Status != TargetOK {
+			return false
+		}
+	}
+	return true
+}
+
+// Candidate returns the checkable form of the proxy
+func (p Proxy) Candidate() Candidate {
+	return Candidate{
+		Address:  p.Address,
+		Protocol: p.Protocol,
+		Username: p.Username,
+		Password: p.Password,
+		Country:  p.Country,
+		Sources:  p.Sources,
+	}
+}
+
+// HasCredentials reports whether the proxy requires authentication
+func (p Proxy) HasCredentials() bool {
+	return p.Username != "" || p.Password != ""
+}
+
+// WithoutCredentials returns a copy of the proxy with its credentials
+// removed and marked as redacted
+func (p Proxy) WithoutCredentials() Proxy {
+	if p.HasCredentials() {
+		p.Username, p.Password, p.Redacted = "", "", true
+	}
+	return p
+}
+
+// String returns the proxy URL with the password masked, so a proxy that
+// ends up in a log line does not leak it
+func (p Proxy) String() string {
+	return p.Candidate().String()
+}
+
+// P90 returns the 90th percentile latency, falling back to the last
+// measurement for proxies without statistics
+func (p Proxy) P90() int64 {
+	if p.Latency != nil {
+		return p.Latency.P90Ms
+	}
+	return p.LatencyMs
+}
+
+// Candidate is a proxy found by a source, together with whatever metadata
+// the source published about it, before it has been checked
+type Candidate struct {
+	Address  string `json:"address"`            // host:port, IPv6 hosts in brackets
+	Protocol string `json:"protocol,omitempty"` // "http", "https", "socks4", "socks5"; empty means http
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Country  string `json:"country,omitempty"`
+
+	// Sources names every source that listed the proxy; ingested ones
+	// appear as "ingest://<name>", archive entries as "<name>#<entry>"
+	Sources []string `json:"sources,omitempty"`
+
+	Entry string `json:"-"` // archive entry the candidate was read from
+}
+
+// Scheme returns the protocol, defaulting to http
+func (c Candidate) Scheme() string {
+	if c.Protocol == "" {
+		return "http"
+	}
+	return c.Protocol
+}
+
+// URL returns the proxy URL including credentials
+func (c Candidate) URL() *url.URL {
+	u := &url.URL{Scheme: c.Scheme(), Host: c.Address}
+	if c.Username != "" || c.Password != "" {
+		u.User = url.UserPassword(c.Username, c.Password)
+	}
+	return u
+}
+
+// String returns the proxy URL with the password masked
+func (c Candidate) String() string {
+	return c.URL().Redacted()
+}
+
+// Key is the normalized identity used for deduplication: the same endpoint
+// with different credentials is a different proxy
+func (c Candidate) Key() string {
+	key := c.Scheme() + "://"
+	if c.Username != "" || c.Password != "" {
+		key += c.Username + ":" + c.Password + "@"
+	}
+	return key + strings.ToLower(c.Address)
+}
+
+// HasSource reports whether the proxy was listed by any of the sources,
+// given by name or as "<name>#<entry>"
+func (p Proxy) HasSource(sources ...string) bool {
+	for _, have := range p.Sources {
+		for _, want := range sources {
+			if have == want || SourceName(have) == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Kbps returns the measured throughput in kilobits per second
+func (p Proxy) Kbps() int64 {
+	return p.BytesPerSec * 8 / 1000
+}
+
+// Egress identifies the address the proxy's traffic leaves from: the
+// detected exit IP, or the proxy's own host when it was not detected
+func (p Proxy) Egress() string {
+	if p.ExitIP != "" {
+		return p.ExitIP
+	}
+	if host, _, err := net.SplitHostPort(p.Address); err == nil {
+		return host
+	}
+	return p.Address
+}
+
+// SourceName strips the archive entry from a provenance item
+func SourceName(provenance string) string {
+	if i := strings.IndexByte(provenance, '#'); i >= 0 {
+		return provenance[:i]
+	}
+	return provenance
+}
+
+// SourceYield counts a source's candidates and how many of them were alive
+// at the last check
+type SourceYield struct {
+	Found int     `json:"found"`
+	Alive int     `json:"alive"`
+	Yield float64 `json:"yield"`
 }
 
 // Stats holds proxy statistics
 type Stats struct {
-	TotalScraped  int         `json:"total_scraped"`
-	TotalAlive    int         `json:"total_alive"`
-	TotalDead     int         `json:"total_dead"`
-	AlivePercent  float64     `json:"alive_percent"`
-	LastCheckTime time.Time   `json:"last_check_time"`
-	SourceStats   interface{} `json:"source_stats,omitempty"`
-	ByProtocol    map[string]struct {
+	TotalScraped   int                    `json:"total_scraped"`
+	TotalAlive     int                    `json:"total_alive"`
+	TotalDead      int                    `json:"total_dead"`
+	AlivePercent   float64                `json:"alive_percent"`
+	LastCheckTime  time.Time              `json:"last_check_time"`
+	SourceStats    interface{}            `json:"source_stats,omitempty"`
+	BySource       map[string]SourceYield `json:"by_source,omitempty"`
+	DistinctEgress int                    `json:"distinct_egress"`    // alive proxies counted once per egress address
+	Filtered       map[string]int         `json:"filtered,omitempty"` // candidates dropped before checking, by reason
+	ByProtocol     map[string]struct {
 		Scraped int `json:"scraped"`
 		Alive   int `json:"alive"`
 		Dead    int `json:"dead"`
@@ -32,4 +234,3 @@ type Snapshot struct {
 	Stats   Stats     `json:"stats"`
 	Updated time.Time `json:"updated"`
 }
-